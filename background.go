@@ -0,0 +1,51 @@
+package gopisysfs
+
+import (
+	"sync"
+)
+
+// background tracks the goroutines this library starts, with the functions that stop them, so Shutdown can stop them all.
+var background = struct {
+	mu    sync.Mutex
+	next  int
+	stops map[int]func()
+	wg    sync.WaitGroup
+}{
+	stops: make(map[int]func()),
+}
+
+// startBackground registers a goroutine that is about to be started, along with the function that stops it.
+// The stop function may be called more than once. The returned function has to be called when the goroutine exits.
+func startBackground(stop func()) func() {
+	background.mu.Lock()
+	defer background.mu.Unlock()
+
+	id := background.next
+	background.next++
+	background.stops[id] = stop
+	background.wg.Add(1)
+
+	return func() {
+		background.mu.Lock()
+		delete(background.stops, id)
+		background.mu.Unlock()
+		background.wg.Done()
+	}
+}
+
+// Shutdown stops all the port monitors, value feeders, and I2C pollers that this library has started, and
+// waits for them to exit. Their channels are closed. Ports are not reset, see GPIOPort.Reset for that.
+func Shutdown() {
+	background.mu.Lock()
+	stops := make([]func(), 0, len(background.stops))
+	for _, stop := range background.stops {
+		stops = append(stops, stop)
+	}
+	background.mu.Unlock()
+
+	info("Shutting down %v background routines\n", len(stops))
+	for _, stop := range stops {
+		stop()
+	}
+	background.wg.Wait()
+}
@@ -0,0 +1,34 @@
+package gopisysfs
+
+// BitWriter is an io.Writer that shifts bytes out through a GPIO output port, one bit at a time, most significant bit first.
+// After each bit is set on the port the clock function is called, which is expected to pulse a clock line, wait for
+// a bit period, or both.
+// The timing is paced by software and by sysfs writes, so it is only suitable for simple, slow, protocols.
+type BitWriter struct {
+	port  GPIOPort
+	clock func() error
+}
+
+// NewBitWriter creates a BitWriter that sets the bits on the port, which should already be enabled as an output,
+// calling clock after each one. An error from clock stops the Write.
+func NewBitWriter(port GPIOPort, clock func() error) *BitWriter {
+	return &BitWriter{
+		port:  port,
+		clock: clock,
+	}
+}
+
+// Write shifts out each byte of data, and returns the number of bytes completely written.
+func (w *BitWriter) Write(data []byte) (int, error) {
+	for i, b := range data {
+		for bit := uint(8); bit > 0; bit-- {
+			if err := w.port.SetValue(b&(1<<(bit-1)) != 0); err != nil {
+				return i, err
+			}
+			if err := w.clock(); err != nil {
+				return i, err
+			}
+		}
+	}
+	return len(data), nil
+}
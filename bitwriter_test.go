@@ -0,0 +1,56 @@
+package gopisysfs
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBitWriter(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	log := &writeLog{FileSystem: fs}
+	SetFileSystem(log)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenOutput(testoutport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	clocks := 0
+	writer := NewBitWriter(port, func() error {
+		clocks++
+		return nil
+	})
+	log.writes = nil
+	if n, err := writer.Write([]byte{0xa5}); err != nil || n != 1 {
+		t.Fatalf("Expected 1 byte written but got %v: %v", n, err)
+	}
+	expect := "value=1 value=0 value=1 value=0 value=0 value=1 value=0 value=1"
+	if got := strings.Join(log.writes, " "); got != expect {
+		t.Errorf("Expected the bits most significant first %v but got %v", expect, got)
+	}
+	if clocks != 8 {
+		t.Errorf("Expected a clock after each of 8 bits but got %v", clocks)
+	}
+
+	// the clock fails on the 4th bit of the second byte
+	clockerr := errors.New("clock failed")
+	clocks = 0
+	writer = NewBitWriter(port, func() error {
+		if clocks++; clocks == 12 {
+			return clockerr
+		}
+		return nil
+	})
+	if n, err := writer.Write([]byte{0xff, 0x00, 0xff}); err != clockerr || n != 1 {
+		t.Errorf("Expected 1 complete byte and the clock error, but got %v: %v", n, err)
+	}
+	if clocks != 12 {
+		t.Errorf("Expected the write to stop at the failed clock, but got %v clocks", clocks)
+	}
+}
@@ -0,0 +1,59 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Blink flashes the port count times, high for half the period and then low for the other half, or until the returned
+// stop function is called if count is 0 or less. The port needs to be enabled, and is made an output (starting low)
+// if it is not one already. The blinking runs in the background, and the port is left low when it ends. A failure
+// to set the value is logged, and ends the blinking.
+func Blink(port GPIOPort, period time.Duration, count int) (func(), error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("%v blink period %v needs to be positive", port, period)
+	}
+	output, err := port.IsOutput()
+	if err != nil {
+		return nil, err
+	}
+	if !output {
+		if err := port.SetMode(GPIOOutputLow); err != nil {
+			return nil, err
+		}
+	}
+
+	killer := make(chan bool)
+	var once sync.Once
+	stop := func() {
+		once.Do(func() { close(killer) })
+	}
+
+	done := startBackground(stop)
+	go func() {
+		defer done()
+		defer func() {
+			if err := port.SetValue(false); err != nil {
+				warn("%v unable to end blinking low: %v\n", port, err)
+			}
+		}()
+
+		half := period / 2
+		for i := 0; count <= 0 || i < count; i++ {
+			for _, value := range []bool{true, false} {
+				if err := port.SetValue(value); err != nil {
+					errorf("%v blinking stopped: %v\n", port, err)
+					return
+				}
+				select {
+				case <-killer:
+					return
+				case <-time.After(half):
+				}
+			}
+		}
+	}()
+
+	return stop, nil
+}
@@ -0,0 +1,46 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlink(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenInput(testoutport, GPIOEdgeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	if _, err := Blink(port, 0, 1); err == nil {
+		t.Errorf("Expected an error for a zero period")
+	}
+	before := port.Metrics()
+	stop, err := Blink(port, 2*time.Millisecond, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if output, err := port.IsOutput(); err != nil || !output {
+		t.Errorf("Expected the port to be made an output (%v)", err)
+	}
+
+	// 3 blinks of 2 writes, and the final low
+	deadline := time.Now().Add(time.Second)
+	for port.Metrics().Writes < before.Writes+1+7 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if writes := port.Metrics().Writes - before.Writes; writes != 1+7 {
+		t.Errorf("Expected the mode and 7 value writes but got %v", writes)
+	}
+	if val, err := port.Value(); err != nil || val {
+		t.Errorf("Expected the port to end low (%v)", err)
+	}
+}
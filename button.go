@@ -0,0 +1,199 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultButtonDebounce is the debounce of a Button's watch when the ButtonConfig does not specify one
+	DefaultButtonDebounce = 20 * time.Millisecond
+	// DefaultLongPress is how long a Button has to be held for a ButtonLongPress when the ButtonConfig does not specify it
+	DefaultLongPress = time.Second
+)
+
+// ButtonGesture is the kind of a ButtonEvent
+type ButtonGesture int
+
+const (
+	// ButtonPress is a short press and release of the button
+	ButtonPress ButtonGesture = iota
+	// ButtonLongPress is a button held for the LongPress threshold, reported while it is still held
+	ButtonLongPress
+	// ButtonDoubleClick is a second short press that starts within the DoubleClick window of the first press's release
+	ButtonDoubleClick
+)
+
+func (g ButtonGesture) String() string {
+	switch g {
+	case ButtonPress:
+		return "press"
+	case ButtonLongPress:
+		return "long press"
+	case ButtonDoubleClick:
+		return "double click"
+	}
+	return fmt.Sprintf("ButtonGesture(%d)", int(g))
+}
+
+// ButtonEvent reports a gesture recognised by a Button
+type ButtonEvent struct {
+	Gesture ButtonGesture
+	// Timestamp is when the (last) press of the gesture started, and Held is how long that press was held,
+	// which for a ButtonLongPress is the LongPress threshold
+	Timestamp time.Time
+	Held      time.Duration
+}
+
+// ButtonConfig configures how a Button recognises gestures from the port's edges
+type ButtonConfig struct {
+	// ActiveLow is true for a button that reads low when it is pressed, like one that shorts a pulled up port to ground
+	ActiveLow bool
+	// Debounce is the debounce of the port's watch, or 0 for DefaultButtonDebounce
+	Debounce time.Duration
+	// LongPress is how long the button has to be held for a ButtonLongPress, or 0 for DefaultLongPress
+	LongPress time.Duration
+	// DoubleClick is the window after a short press is released that a second press makes a ButtonDoubleClick.
+	// A ButtonPress is only reported once the window passes without one. The default of 0 disables double clicks,
+	// and reports each ButtonPress as soon as the button is released.
+	DoubleClick time.Duration
+}
+
+// Button watches the port, an input connected to a push button, and reports the gestures made with it, instead of
+// the raw edges. The port needs to be an enabled input that can signal both edges. A button that is pressed when
+// the watch starts is ignored until it is released. Gestures are dropped if the channel's buffer is full.
+// The channel is closed when the returned stop function is called, or when the port is reset.
+func Button(port GPIOPort, cfg ButtonConfig) (<-chan ButtonEvent, func(), error) {
+	if cfg.Debounce < 0 || cfg.LongPress < 0 || cfg.DoubleClick < 0 {
+		return nil, nil, fmt.Errorf("%v button durations %+v can not be negative", port, cfg)
+	}
+	if cfg.Debounce == 0 {
+		cfg.Debounce = DefaultButtonDebounce
+	}
+	if cfg.LongPress == 0 {
+		cfg.LongPress = DefaultLongPress
+	}
+	events, stop, err := port.Watch(WatchConfig{Edge: GPIOEdgeBoth, Debounce: cfg.Debounce})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gestures := make(chan ButtonEvent, DefaultWatchBuffer)
+	done := startBackground(stop)
+	go func() {
+		defer done()
+		buttonGestures(events, gestures, cfg)
+	}()
+
+	return gestures, stop, nil
+}
+
+// buttonGestures recognises the gestures in the events, and closes the gestures when the events are closed
+func buttonGestures(events <-chan Event, gestures chan ButtonEvent, cfg ButtonConfig) {
+
+	defer close(gestures)
+
+	send := func(event ButtonEvent) {
+		select {
+		case gestures <- event:
+		default:
+			warn("Button dropped %v: receive channel overflow\n", event.Gesture)
+		}
+	}
+
+	// the timers run while a press may become long, and while a released press may become a double click
+	var longtimer, clicktimer *time.Timer
+	var longpress, clickwindow <-chan time.Time
+	defer func() {
+		if longtimer != nil {
+			longtimer.Stop()
+		}
+		if clicktimer != nil {
+			clicktimer.Stop()
+		}
+	}()
+
+	// the first event is the value when the watch started, and a press in progress then is ignored
+	initial := true
+	ignore := false
+	down := false
+	var pressed time.Time
+	// clicked holds the press that is waiting for the double click window to pass, and second is true while the
+	// button is pressed again within that window
+	var clicked *ButtonEvent
+	second := false
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				if clicked != nil {
+					send(*clicked)
+				}
+				return
+			}
+			value := event.Value != cfg.ActiveLow
+			if initial {
+				initial = false
+				down, ignore = value, value
+				continue
+			}
+			if value == down {
+				continue
+			}
+			down = value
+
+			if down {
+				pressed = event.Timestamp
+				longtimer = time.NewTimer(cfg.LongPress)
+				longpress = longtimer.C
+				if clicked != nil {
+					clicktimer.Stop()
+					clickwindow = nil
+					second = true
+				}
+				continue
+			}
+
+			if ignore {
+				ignore = false
+				continue
+			}
+			if longpress == nil {
+				// already reported as a long press
+				continue
+			}
+			longtimer.Stop()
+			longpress = nil
+			held := event.Timestamp.Sub(pressed)
+			if second {
+				second = false
+				clicked = nil
+				send(ButtonEvent{Gesture: ButtonDoubleClick, Timestamp: pressed, Held: held})
+				continue
+			}
+			if cfg.DoubleClick <= 0 {
+				send(ButtonEvent{Gesture: ButtonPress, Timestamp: pressed, Held: held})
+				continue
+			}
+			clicked = &ButtonEvent{Gesture: ButtonPress, Timestamp: pressed, Held: held}
+			clicktimer = time.NewTimer(cfg.DoubleClick)
+			clickwindow = clicktimer.C
+
+		case <-longpress:
+			longpress = nil
+			if second {
+				// a long second press does not make a double click, so the first press is on its own
+				second = false
+				send(*clicked)
+				clicked = nil
+			}
+			send(ButtonEvent{Gesture: ButtonLongPress, Timestamp: pressed, Held: cfg.LongPress})
+
+		case <-clickwindow:
+			clickwindow = nil
+			send(*clicked)
+			clicked = nil
+		}
+	}
+}
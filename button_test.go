@@ -0,0 +1,69 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestButtonGestures(t *testing.T) {
+	events := make(chan Event)
+	gestures := make(chan ButtonEvent, DefaultWatchBuffer)
+	go buttonGestures(events, gestures, ButtonConfig{LongPress: 50 * time.Millisecond, DoubleClick: 30 * time.Millisecond})
+
+	base := time.Now()
+	edge := func(value bool, at time.Duration) {
+		events <- Event{Value: value, Timestamp: base.Add(at)}
+	}
+	expect := func(gesture ButtonGesture, at, held time.Duration) {
+		select {
+		case event := <-gestures:
+			if event.Gesture != gesture || !event.Timestamp.Equal(base.Add(at)) || event.Held != held {
+				t.Errorf("Expected a %v at %v held %v but got %+v", gesture, at, held, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a %v at %v", gesture, at)
+		}
+	}
+
+	edge(false, 0)
+	edge(true, 0)
+	edge(false, 10*time.Millisecond)
+	expect(ButtonPress, 0, 10*time.Millisecond)
+
+	edge(true, 100*time.Millisecond)
+	edge(false, 110*time.Millisecond)
+	edge(true, 120*time.Millisecond)
+	edge(false, 135*time.Millisecond)
+	expect(ButtonDoubleClick, 120*time.Millisecond, 15*time.Millisecond)
+
+	edge(true, 200*time.Millisecond)
+	expect(ButtonLongPress, 200*time.Millisecond, 50*time.Millisecond)
+	edge(false, 300*time.Millisecond)
+
+	close(events)
+	for event := range gestures {
+		t.Errorf("Expected no more gestures but got %+v", event)
+	}
+}
+
+func TestButtonInitiallyPressed(t *testing.T) {
+	events := make(chan Event)
+	gestures := make(chan ButtonEvent, DefaultWatchBuffer)
+	go buttonGestures(events, gestures, ButtonConfig{ActiveLow: true, LongPress: time.Hour})
+
+	base := time.Now()
+	// an active low button is pressed at the start, and released
+	events <- Event{Value: false, Timestamp: base}
+	events <- Event{Value: true, Timestamp: base.Add(10 * time.Millisecond)}
+	events <- Event{Value: false, Timestamp: base.Add(20 * time.Millisecond)}
+	events <- Event{Value: true, Timestamp: base.Add(25 * time.Millisecond)}
+	close(events)
+
+	var got []ButtonEvent
+	for event := range gestures {
+		got = append(got, event)
+	}
+	if len(got) != 1 || got[0].Gesture != ButtonPress || got[0].Held != 5*time.Millisecond {
+		t.Errorf("Expected only the second press but got %+v", got)
+	}
+}
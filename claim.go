@@ -0,0 +1,117 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// gpiolib lists each line, and the consumer that requested it, in debugfs
+	sys_debug_gpio = "sys/kernel/debug/gpio"
+)
+
+// IsPinClaimed reports whether the port's pin is in use, and by whom: either requested from gpiolib by a consumer
+// (which is "sysfs" for an exported port), or muxed to a device by a driver, like a UART or I2C overlay. It needs
+// debugfs (mounted on /sys/kernel/debug, usually only readable by root), and returns an error if it is unavailable.
+func IsPinClaimed(port int) (bool, string, error) {
+	gpiostate, gpioerr := readFile(file(sys_debug_gpio))
+	if gpioerr == nil {
+		if owner, ok := gpioConsumer(gpiostate, port); ok {
+			return true, owner, nil
+		}
+	}
+	owner, ok, muxerr := pinmuxOwner(port)
+	if muxerr != nil && gpioerr != nil {
+		return false, "", fmt.Errorf("GPIO %v claims are unknown, debugfs is unavailable: %v", port, gpioerr)
+	}
+	return ok, owner, nil
+}
+
+// gpioConsumer finds the consumer of the port in the gpiolib debug listing, where requested lines look like
+// " gpio-14  (TXD1                |sysfs               ) in  hi"
+func gpioConsumer(state string, port int) (string, bool) {
+	prefix := fmt.Sprintf("gpio-%d ", port)
+	for _, line := range strings.Split(state, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		open := strings.Index(line, "(")
+		end := strings.LastIndex(line, ")")
+		if open < 0 || end < open {
+			return "", false
+		}
+		label := line[open+1 : end]
+		pipe := strings.Index(label, "|")
+		if pipe < 0 {
+			// just the line name, it is not requested
+			return "", false
+		}
+		consumer := strings.TrimSpace(label[pipe+1:])
+		return consumer, consumer != ""
+	}
+	return "", false
+}
+
+// pinmuxOwner finds the device that a pinctrl driver muxed the port's pin to, where the pinmux-pins listing looks like
+// "pin 14 (gpio14): fe201000.serial (GPIO UNCLAIMED) function alt0 group gpio14"
+func pinmuxOwner(port int) (string, bool, error) {
+	root := file(sys_pinctrl)
+	nodes, err := filesystem.ReadDir(root)
+	if err != nil {
+		return "", false, err
+	}
+	prefix := fmt.Sprintf("pin %d (gpio%d): ", port, port)
+	found := false
+	for _, node := range nodes {
+		pins, err := readFile(filepath.Join(root, node.Name(), "pinmux-pins"))
+		if err != nil {
+			continue
+		}
+		found = true
+		for _, line := range strings.Split(pins, "\n") {
+			if !strings.HasPrefix(line, prefix) {
+				continue
+			}
+			fields := strings.Fields(strings.TrimPrefix(line, prefix))
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "(") {
+				// (MUX UNCLAIMED)
+				return "", false, nil
+			}
+			owner := fields[0]
+			for i := range fields {
+				if fields[i] == "function" && i+1 < len(fields) {
+					owner = fmt.Sprintf("%v (function %v)", owner, fields[i+1])
+				}
+			}
+			return owner, true, nil
+		}
+	}
+	if !found {
+		return "", false, fmt.Errorf("No pinmux-pins listing in %v", root)
+	}
+	return "", false, nil
+}
+
+// AvailableGPIOPorts returns the P1GPIOPorts that can really be used as GPIO right now: those the GPIO chips provide,
+// and that no driver has claimed, for example for a UART or I2C overlay. Ports exported through sysfs are GPIO, and
+// are included. IsPinClaimed says who owns an excluded port. It needs debugfs, like IsPinClaimed.
+func (p *pi) AvailableGPIOPorts() ([]int, error) {
+	ports := []int{}
+	for _, port := range p.P1GPIOPorts() {
+		if checkAvailable(port) != nil {
+			continue
+		}
+		claimed, owner, err := IsPinClaimed(port)
+		if err != nil {
+			return nil, err
+		}
+		if claimed && owner != "sysfs" {
+			debug("GPIO %v is not available, it is owned by %v\n", port, owner)
+			continue
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
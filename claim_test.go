@@ -0,0 +1,78 @@
+package gopisysfs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIsPinClaimed(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	if _, _, err := IsPinClaimed(testoutport); err == nil {
+		t.Errorf("Expected an error without debugfs")
+	}
+
+	fs.AddFile(sys_debug_gpio, []byte("gpiochip0: GPIOs 0-53, parent: platform/3f200000.gpio, pinctrl-bcm2835:\n"+
+		" gpio-14  (TXD1                )\n"+
+		" gpio-23  (GPIO23              |sysfs               ) out hi\n"+
+		" gpio-24  (GPIO24              )\n"))
+	fs.AddFile(filepath.Join(sys_pinctrl, "3f200000.gpio", "pinmux-pins"), []byte("Pinmux settings per pin\n"+
+		"pin 14 (gpio14): 3f201000.serial (GPIO UNCLAIMED) function alt0 group gpio14\n"+
+		"pin 24 (gpio24): (MUX UNCLAIMED) (GPIO UNCLAIMED)\n"))
+
+	for _, tc := range []struct {
+		port    int
+		claimed bool
+		owner   string
+	}{
+		{testoutport, true, "sysfs"},
+		{testinport, false, ""},
+		{14, true, "3f201000.serial (function alt0)"},
+	} {
+		claimed, owner, err := IsPinClaimed(tc.port)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed != tc.claimed || owner != tc.owner {
+			t.Errorf("Expected GPIO %v claimed %v by %q but got %v by %q", tc.port, tc.claimed, tc.owner, claimed, owner)
+		}
+	}
+}
+
+func TestAvailableGPIOPorts(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	board := GetDetailsFor(testrevision, testmodel)
+	if _, err := board.AvailableGPIOPorts(); err == nil {
+		t.Errorf("Expected an error without debugfs")
+	}
+
+	fs.AddFile(sys_debug_gpio, []byte(" gpio-23  (GPIO23              |sysfs               ) out hi\n"))
+	fs.AddFile(filepath.Join(sys_pinctrl, "3f200000.gpio", "pinmux-pins"), []byte(
+		"pin 14 (gpio14): 3f201000.serial (GPIO UNCLAIMED) function alt0 group gpio14\n"+
+			"pin 15 (gpio15): 3f201000.serial (GPIO UNCLAIMED) function alt0 group gpio15\n"))
+	ports, err := board.AvailableGPIOPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	available := map[int]bool{}
+	for _, port := range ports {
+		available[port] = true
+	}
+	if available[14] || available[15] {
+		t.Errorf("Expected the UART pins to be excluded from %v", ports)
+	}
+	if !available[testoutport] || !available[testinport] {
+		t.Errorf("Expected GPIO pins %v and %v in %v", testoutport, testinport, ports)
+	}
+	if len(ports) != len(board.P1GPIOPorts())-2 {
+		t.Errorf("Expected all but 2 of %v in %v", board.P1GPIOPorts(), ports)
+	}
+}
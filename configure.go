@@ -0,0 +1,129 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InputSpec describes the configuration of an input port, for ConfigureInputs
+type InputSpec struct {
+	Pin       int
+	Edge      GPIOEdge
+	ActiveLow bool
+	// Debounce, if positive, becomes the debounce of the port's watches that do not specify one (see WatchConfig)
+	Debounce time.Duration
+}
+
+// PinErrors maps the pins that failed in a bulk configuration to the reason each failed
+type PinErrors map[int]error
+
+func (pe PinErrors) Error() string {
+	pins := make([]int, 0, len(pe))
+	for pin := range pe {
+		pins = append(pins, pin)
+	}
+	sort.Ints(pins)
+	msgs := make([]string, len(pins))
+	for i, pin := range pins {
+		msgs[i] = fmt.Sprintf("pin %v: %v", pin, pe[pin])
+	}
+	return fmt.Sprintf("Unable to configure %v pins: %v", len(pins), strings.Join(msgs, "; "))
+}
+
+// ConfigureInputs enables and configures each of the specified input ports, like OpenInput. All the specs are
+// applied even if some fail, and the failures are returned as PinErrors, so the error says which pins to look at.
+// A port that fails is reset again (if it was not already enabled), the others stay configured.
+func (p *pi) ConfigureInputs(specs []InputSpec) error {
+	failed := PinErrors{}
+	for _, spec := range specs {
+		spec := spec
+		if spec.Debounce < 0 {
+			failed[spec.Pin] = fmt.Errorf("GPIO %v debounce %v can not be negative", spec.Pin, spec.Debounce)
+			continue
+		}
+		_, err := p.open(spec.Pin, func(gp *gport) error {
+			if err := gp.SetMode(GPIOInput); err != nil {
+				return err
+			}
+			if err := gp.setActiveLow(spec.ActiveLow); err != nil {
+				return err
+			}
+			if err := gp.setEdge(spec.Edge); err != nil {
+				return err
+			}
+			gp.setDebounce(spec.Debounce)
+			return nil
+		})
+		if err != nil {
+			failed[spec.Pin] = err
+			continue
+		}
+		p.lock()
+		p.configured[spec.Pin] = spec
+		p.unlock(true)
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	return nil
+}
+
+// PinMismatch reports an attribute of a configured port that does not read back as it was configured
+type PinMismatch struct {
+	Pin int
+	// Attribute is the sysfs attribute that differs: "enabled", "direction", "edge", or "active_low"
+	Attribute string
+	Expected  string
+	Actual    string
+}
+
+func (m PinMismatch) String() string {
+	return fmt.Sprintf("GPIO %v %v is %v, expected %v", m.Pin, m.Attribute, m.Actual, m.Expected)
+}
+
+// VerifyConfiguration reads back each port configured by ConfigureInputs, and reports the attributes that no longer
+// match the spec, in pin order. That catches ports that another process reset or reconfigured, and writes that sysfs
+// ignored without an error. A port that was reset, even by this process, is reported as not enabled. Ports that can
+// not be read are returned as PinErrors, and the other ports are still verified.
+func (p *pi) VerifyConfiguration() ([]PinMismatch, error) {
+	p.lock()
+	specs := make([]InputSpec, 0, len(p.configured))
+	for _, spec := range p.configured {
+		specs = append(specs, spec)
+	}
+	p.unlock(true)
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Pin < specs[j].Pin })
+
+	mismatches := []PinMismatch{}
+	failed := PinErrors{}
+	for _, spec := range specs {
+		port, err := p.GetPort(spec.Pin)
+		if err != nil {
+			failed[spec.Pin] = err
+			continue
+		}
+		state, err := port.Snapshot()
+		if err != nil {
+			failed[spec.Pin] = err
+			continue
+		}
+		check := func(attribute string, expected, actual interface{}) {
+			if expected != actual {
+				mismatches = append(mismatches, PinMismatch{spec.Pin, attribute, fmt.Sprint(expected), fmt.Sprint(actual)})
+			}
+		}
+		check("enabled", true, state.Enabled)
+		if !state.Enabled {
+			continue
+		}
+		check("direction", GPIOInput, state.Direction)
+		check("edge", spec.Edge, state.Edge)
+		check("active_low", spec.ActiveLow, state.ActiveLow)
+	}
+	if len(failed) > 0 {
+		return mismatches, failed
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,92 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfigureInputs(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	fs.SetEdgeless(testinport + 1)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	board := GetDetailsFor(testrevision, testmodel)
+	err := board.ConfigureInputs([]InputSpec{
+		{Pin: testinport, Edge: GPIOEdgeFalling, ActiveLow: true, Debounce: 10 * time.Millisecond},
+		{Pin: testinport + 1, Edge: GPIOEdgeRising},
+		{Pin: 100},
+	})
+	failed, ok := err.(PinErrors)
+	if !ok {
+		t.Fatalf("Expected PinErrors but got %v", err)
+	}
+	if len(failed) != 2 || failed[testinport+1] == nil || failed[100] == nil {
+		t.Errorf("Expected pins %v and 100 to fail but got %v", testinport+1, failed)
+	}
+
+	port, err := board.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+	state, err := port.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (PortState{Enabled: true, Direction: GPIOInput, Edge: GPIOEdgeFalling, ActiveLow: true}); state != expect {
+		t.Errorf("Expected state %+v but got %+v", expect, state)
+	}
+	if failedport, _ := board.GetPort(testinport + 1); failedport.IsEnabled() {
+		t.Errorf("Expected the failed port to be reset")
+	}
+}
+
+func TestVerifyConfiguration(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	board := GetDetailsFor(testrevision, testmodel)
+	if err := board.ConfigureInputs([]InputSpec{
+		{Pin: testinport, Edge: GPIOEdgeFalling, ActiveLow: true},
+		{Pin: testinport + 1, Edge: GPIOEdgeBoth},
+		{Pin: testinport + 2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for pin := testinport; pin <= testinport+2; pin++ {
+		port, _ := board.GetPort(pin)
+		defer port.Reset()
+	}
+	if mismatches, err := board.VerifyConfiguration(); err != nil || len(mismatches) != 0 {
+		t.Fatalf("Expected the configuration to verify but got %v: %v", mismatches, err)
+	}
+
+	// another process changes the edge of one port, and resets another
+	gpio := file(sys_gpio)
+	if err := fs.WriteFile(filepath.Join(gpio, fmt.Sprintf("gpio%d", testinport), "edge"), []byte("rising")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.WriteFile(filepath.Join(gpio, "unexport"), []byte(fmt.Sprint(testinport+1))); err != nil {
+		t.Fatal(err)
+	}
+
+	mismatches, err := board.VerifyConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []PinMismatch{
+		{Pin: testinport, Attribute: "edge", Expected: "falling", Actual: "rising"},
+		{Pin: testinport + 1, Attribute: "enabled", Expected: "true", Actual: "false"},
+	}
+	if fmt.Sprint(mismatches) != fmt.Sprint(expect) {
+		t.Errorf("Expected mismatches %v but got %v", expect, mismatches)
+	}
+}
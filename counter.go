@@ -0,0 +1,67 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"time"
+)
+
+// CountStream counts the port's edges, and sends the cumulative count on the returned channel every emitEvery, for
+// counters like a tipping-bucket rain gauge. GPIOEdgeNone counts both edges, as with Watch. Only the latest count is
+// kept for a consumer that falls behind, and the final count is sent before the channel is closed, when the returned
+// stop function is called, or when the port is reset. Edges that the monitor loses (see PulseCapture) are not counted.
+func (p *gport) CountStream(edge GPIOEdge, emitEvery time.Duration) (<-chan uint64, func(), error) {
+	if emitEvery <= 0 {
+		return nil, nil, fmt.Errorf("GPIO %v count interval %v needs to be positive", p.port, emitEvery)
+	}
+	events, stop, err := p.Watch(WatchConfig{Edge: edge})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counts := make(chan uint64, 1)
+	done := startBackground(stop)
+	go func() {
+		defer done()
+		tick := time.NewTicker(emitEvery)
+		defer tick.Stop()
+		countEvents(events, counts, tick.C)
+	}()
+
+	return counts, stop, nil
+}
+
+// countEvents counts the events, emitting the count on each tick, and emits the final count and closes the counts
+// when the events are closed
+func countEvents(events <-chan Event, counts chan uint64, tick <-chan time.Time) {
+
+	defer close(counts)
+
+	// emit replaces a count the consumer has not received yet, as only the latest matters
+	emit := func(count uint64) {
+		select {
+		case <-counts:
+		default:
+		}
+		counts <- count
+	}
+
+	var count uint64
+	// the first event is the value when the monitor started, not an edge
+	initial := true
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				emit(count)
+				return
+			}
+			if initial {
+				initial = false
+				continue
+			}
+			count++
+		case <-tick:
+			emit(count)
+		}
+	}
+}
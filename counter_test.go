@@ -0,0 +1,62 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCountEvents(t *testing.T) {
+	events := make(chan Event)
+	counts := make(chan uint64, 1)
+	tick := make(chan time.Time)
+	go countEvents(events, counts, tick)
+
+	// the initial value is not counted
+	for i := 0; i < 4; i++ {
+		events <- Event{Value: true}
+	}
+	tick <- time.Now()
+	if count := <-counts; count != 3 {
+		t.Errorf("Expected a count of 3 but got %v", count)
+	}
+
+	// the consumer falls behind, and only gets the latest count
+	tick <- time.Now()
+	events <- Event{Value: true}
+	tick <- time.Now()
+	events <- Event{Value: true}
+	close(events)
+
+	var final uint64
+	for count := range counts {
+		final = count
+	}
+	if final != 5 {
+		t.Errorf("Expected a final count of 5 but got %v", final)
+	}
+}
+
+func TestCountStream(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+
+	if _, _, err := port.CountStream(GPIOEdgeRising, 0); err == nil {
+		t.Errorf("Expected an error for a zero count interval")
+	}
+	counts, stop, err := port.CountStream(GPIOEdgeRising, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := <-counts; count != 0 {
+		t.Errorf("Expected no edges but got %v", count)
+	}
+	stop()
+	for range counts {
+	}
+	Shutdown()
+}
@@ -1,26 +1,150 @@
 package gopisysfs
 
-import ()
+import (
+	"sync"
+)
 
 // LogFunction declares a signature that can be used for this library to log information to.
 // Set a log function by calling SetLogFn(...).
 type LogFunction func(format string, args ...interface{})
 
+// Logger declares a leveled logging interface that can be used for this library to log information to,
+// as an alternative to a LogFunction. It is satisfied by many structured logging libraries, or a thin adapter to them.
+// Set a logger by calling SetLogger(...).
+type Logger interface {
+	Errorf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+}
+
+// LogLevel indicates the severity of a log message. Use SetLogLevel(...) to control which messages are logged.
+type LogLevel int
+
+const (
+	// LogError messages report failures
+	LogError LogLevel = iota
+	// LogWarn messages report unexpected conditions that the library recovers from
+	LogWarn
+	// LogInfo messages report significant state changes, like enabling or resetting a port
+	LogInfo
+	// LogDebug messages report the detailed progress of operations, like each polling cycle
+	LogDebug
+)
+
+// logmu guards the log function, logger, level, and trace function, which can be set while ports are in use.
+var logmu sync.RWMutex
+
 // The log function we use for logging, may be nil.
 var logfn LogFunction
 
+// The logger we use for leveled logging, may be nil.
+var logger Logger
+
+// The function that sysfs reads and writes are traced to, may be nil.
+var tracefn TraceFunction
+
+// The most verbose level that is sent to the log function.
+var loglevel = LogInfo
+
 // SetLogFn instructs this library to use the specified function to send log messages to.
 // Set to nil to disable loggin.
 // For example `gopisysfs.SetLogFn(log.Printf)` (but note that trace details will be wrong in the log library with that call).
+// The log function, like the Logger and level, can be changed at any time, including while ports are being monitored.
 func SetLogFn(lfn LogFunction) {
+	logmu.Lock()
+	defer logmu.Unlock()
+
 	logfn = lfn
 }
 
-// info is internally used to log details.
-func info(format string, args ...interface{}) {
-	lfn := logfn
-	if lfn == nil {
+// SetLogger instructs this library to send log messages to the methods of the specified Logger matching each message's level.
+// The Logger is used in addition to any function set with SetLogFn(...). Set to nil to disable it.
+func SetLogger(lgr Logger) {
+	logmu.Lock()
+	defer logmu.Unlock()
+
+	logger = lgr
+}
+
+// SetLogLevel limits the messages sent to the log function and Logger to those at the given level, or more severe.
+// The default level is LogInfo. Use LogDebug to see the detailed progress of operations.
+func SetLogLevel(level LogLevel) {
+	logmu.Lock()
+	defer logmu.Unlock()
+
+	loglevel = level
+}
+
+// TraceFunction declares a signature that receives each raw read and write of a sysfs (or procfs) file. The op is
+// "read" or "write", the data is what was read or written (nil if a read failed), and err is the result.
+// Set a trace function by calling TraceSysfs(...).
+type TraceFunction func(op, path string, data []byte, err error)
+
+// TraceSysfs instructs this library to report every sysfs read and write to the specified function, with the exact
+// bytes, for comparing the sequence of accesses against a data sheet or strace. Tracing is independent of the log level.
+// Set to nil (the default) to disable tracing. The data must not be modified or retained by the function.
+func TraceSysfs(tfn TraceFunction) {
+	logmu.Lock()
+	defer logmu.Unlock()
+
+	tracefn = tfn
+}
+
+// trace is internally used to report a sysfs access to the trace function, if there is one.
+func trace(op, path string, data []byte, err error) {
+	logmu.RLock()
+	tfn := tracefn
+	logmu.RUnlock()
+	if tfn != nil {
+		tfn(op, path, data, err)
+	}
+}
+
+// logf is internally used to log details at the given level.
+func logf(level LogLevel, format string, args ...interface{}) {
+	// the functions are called without the lock, so they can log (or set the log function) themselves
+	logmu.RLock()
+	lfn, lgr, max := logfn, logger, loglevel
+	logmu.RUnlock()
+
+	if level > max {
 		return
 	}
-	lfn(format, args...)
+	if lfn != nil {
+		lfn(format, args...)
+	}
+	if lgr == nil {
+		return
+	}
+	switch level {
+	case LogError:
+		lgr.Errorf(format, args...)
+	case LogWarn:
+		lgr.Warnf(format, args...)
+	case LogInfo:
+		lgr.Infof(format, args...)
+	default:
+		lgr.Debugf(format, args...)
+	}
+}
+
+// errorf is internally used to log failures.
+func errorf(format string, args ...interface{}) {
+	logf(LogError, format, args...)
+}
+
+// warn is internally used to log recoverable problems.
+func warn(format string, args ...interface{}) {
+	logf(LogWarn, format, args...)
+}
+
+// info is internally used to log details.
+func info(format string, args ...interface{}) {
+	logf(LogInfo, format, args...)
+}
+
+// debug is internally used to log the chatty details of operations in progress.
+func debug(format string, args ...interface{}) {
+	logf(LogDebug, format, args...)
 }
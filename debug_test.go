@@ -0,0 +1,36 @@
+package gopisysfs
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSetLogFnConcurrent(t *testing.T) {
+	defer SetLogFn(nil)
+	defer SetLogLevel(LogInfo)
+
+	stop := make(chan bool)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				info("Logging while the log function changes\n")
+			}
+		}
+	}()
+
+	// run with -race to check that the log settings are synchronized
+	for i := 0; i < 100; i++ {
+		SetLogFn(func(format string, args ...interface{}) {})
+		SetLogLevel(LogDebug)
+		SetLogFn(nil)
+		SetLogLevel(LogInfo)
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,151 @@
+package gopisysfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// the firmware exposes the HAT ID EEPROM contents here (/proc/device-tree is a link to the devicetree base)
+	sys_hat = "sys/firmware/devicetree/base/hat"
+	// the EEPROM bootloader of the Pi 4 and later reports its version here (this is what rpi-eeprom-update reads)
+	sys_bootloader = "sys/firmware/devicetree/base/chosen/bootloader"
+	// the firmware passes the board details and kernel command line to the kernel in these nodes
+	sys_dtsystem = "sys/firmware/devicetree/base/system"
+	sys_dtchosen = "sys/firmware/devicetree/base/chosen"
+)
+
+// HAT describes an add-on board as identified by its ID EEPROM, which the firmware reads at boot time.
+type HAT struct {
+	Product        string
+	Vendor         string
+	ProductID      string
+	ProductVersion string
+	UUID           string
+}
+
+// ErrNoHAT is returned by HATInfo when no HAT ID EEPROM was detected at boot time.
+var ErrNoHAT = errors.New("No HAT ID EEPROM was detected")
+
+// HATInfo returns the details of the attached HAT, or ErrNoHAT if there is none.
+func (p *pi) HATInfo() (*HAT, error) {
+	hat := file(sys_hat)
+	if !checkFile(hat) {
+		return nil, ErrNoHAT
+	}
+
+	ret := &HAT{}
+	for _, prop := range []struct {
+		name string
+		dest *string
+	}{
+		{"product", &ret.Product},
+		{"vendor", &ret.Vendor},
+		{"product_id", &ret.ProductID},
+		{"product_ver", &ret.ProductVersion},
+		{"uuid", &ret.UUID},
+	} {
+		val, err := readDeviceTree(filepath.Join(hat, prop.name))
+		if err != nil {
+			return nil, err
+		}
+		*prop.dest = val
+	}
+	return ret, nil
+}
+
+// ErrNoBootloader is returned by BootloaderVersion on boards (before the Pi 4) without an EEPROM bootloader,
+// or when the firmware is too old to report its version.
+var ErrNoBootloader = errors.New("No EEPROM bootloader version is reported by the firmware")
+
+// BootloaderVersion returns the version of the EEPROM bootloader the Pi booted with, and its build date, like
+// "8ba17717 (2023-01-11 17:46:20 UTC)", or ErrNoBootloader if it is not known.
+func (p *pi) BootloaderVersion() (string, error) {
+	bootloader := file(sys_bootloader)
+	version, err := readDeviceTree(filepath.Join(bootloader, "version"))
+	if err != nil {
+		if !checkFile(bootloader) {
+			return "", ErrNoBootloader
+		}
+		return "", err
+	}
+	// the build timestamp is a big-endian 32-bit cell of seconds since the epoch
+	stamp, err := readBytes(filepath.Join(bootloader, "build-timestamp"))
+	if err != nil || len(stamp) != 4 {
+		return version, nil
+	}
+	built := time.Unix(int64(binary.BigEndian.Uint32(stamp)), 0).UTC()
+	return fmt.Sprintf("%v (%v)", version, built.Format("2006-01-02 15:04:05 MST")), nil
+}
+
+// ErrNoFirmwareInfo is returned by FirmwareInfo when the firmware reports none of the details, as on a board that
+// is not a Pi, or with a kernel that does not use a device-tree.
+var ErrNoFirmwareInfo = errors.New("No firmware details are reported in the device-tree")
+
+// FirmwareInfo is what the firmware reports about the board and how it booted. Each detail is read on its own, and
+// is empty if the firmware does not report it.
+type FirmwareInfo struct {
+	// Bootloader is the BootloaderVersion, for boards with an EEPROM bootloader
+	Bootloader string
+	// Revision is the board revision code the firmware gave the kernel, like "a22082", which is the same as the
+	// cpuinfo Revision, but is also there when (64-bit) kernels do not list it in /proc/cpuinfo
+	Revision string
+	// Serial is the board serial number the firmware gave the kernel, in hex
+	Serial string
+	// BootArgs is the kernel command line the firmware booted with, after it added its own arguments to cmdline.txt
+	BootArgs string
+}
+
+// FirmwareInfo reads the details the firmware reports in the device-tree, or returns ErrNoFirmwareInfo if there are
+// none. A detail that can not be read is left empty, and does not prevent the others from being returned.
+func (p *pi) FirmwareInfo() (FirmwareInfo, error) {
+	fw := FirmwareInfo{}
+	var err error
+	if fw.Bootloader, err = p.BootloaderVersion(); err != nil {
+		debug("Firmware bootloader is unknown: %v\n", err)
+	}
+	if cell, err := readBytes(file(sys_dtsystem, "linux,revision")); err == nil && len(cell) == 4 {
+		fw.Revision = fmt.Sprintf("%04x", binary.BigEndian.Uint32(cell))
+	}
+	if cells, err := readBytes(file(sys_dtsystem, "linux,serial")); err == nil && len(cells) == 8 {
+		fw.Serial = fmt.Sprintf("%016x", binary.BigEndian.Uint64(cells))
+	}
+	if fw.BootArgs, err = readDeviceTree(file(sys_dtchosen, "bootargs")); err != nil {
+		debug("Firmware boot arguments are unknown: %v\n", err)
+	}
+	if fw == (FirmwareInfo{}) {
+		return fw, ErrNoFirmwareInfo
+	}
+	return fw, nil
+}
+
+// readDeviceTree reads a device-tree string property, which (unlike regular sysfs files) is NUL terminated
+func readDeviceTree(name string) (string, error) {
+	data, err := readBytes(name)
+	if err != nil {
+		return "", err
+	}
+	str := strings.TrimRight(string(data), "\x00")
+	str = strings.TrimSpace(str)
+	return str, nil
+}
+
+// readDeviceTreeList reads a device-tree string-list property, where each value is NUL terminated
+func readDeviceTreeList(name string) ([]string, error) {
+	data, err := readBytes(name)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, str := range strings.Split(string(data), "\x00") {
+		str = strings.TrimSpace(str)
+		if str != "" {
+			ret = append(ret, str)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,94 @@
+package gopisysfs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHATInfo(t *testing.T) {
+	pi := GetDetailsFor(testrevision, testmodel)
+	hat, err := pi.HATInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hat.Product != "Sense HAT" {
+		t.Errorf("Expected product '%v' but got %q", "Sense HAT", hat.Product)
+	}
+	if hat.ProductID != "0x0001" {
+		t.Errorf("Expected product id '%v' but got %q", "0x0001", hat.ProductID)
+	}
+	t.Logf("Got HAT %+v", hat)
+}
+
+func TestReadDeviceTreeNUL(t *testing.T) {
+	model, err := readDeviceTree(file(sys_model))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model != testmodel {
+		t.Errorf("Expected model %q but got %q", testmodel, model)
+	}
+
+	compat, err := readDeviceTreeList(file(sys_compat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compat) != 2 || compat[0] != "raspberrypi,3-model-b" || compat[1] != "brcm,bcm2837" {
+		t.Errorf("Expected 2 compatible entries but got %q", compat)
+	}
+}
+
+func TestCompatible(t *testing.T) {
+	compat := GetPi().Compatible()
+	if len(compat) != 2 || compat[0] != "raspberrypi,3-model-b" {
+		t.Errorf("Expected the compatible list from the device-tree but got %q", compat)
+	}
+	if det := GetDetailsFor(testrevision, testmodel).Compatible(); len(det) != 0 {
+		t.Errorf("Expected no compatible list for explicit details but got %q", det)
+	}
+}
+
+func TestBootloaderVersion(t *testing.T) {
+	pi := GetDetailsFor(testrevision, testmodel)
+	if _, err := pi.BootloaderVersion(); err != ErrNoBootloader {
+		t.Errorf("Expected ErrNoBootloader on a Pi 3 but got %v", err)
+	}
+
+	fs := NewMemFS()
+	fs.AddFile(filepath.Join(sys_bootloader, "version"), []byte("8ba17717\x00"))
+	fs.AddFile(filepath.Join(sys_bootloader, "build-timestamp"), []byte{0x63, 0xbe, 0xf5, 0xec})
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	version, err := pi.BootloaderVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "8ba17717 (2023-01-11 17:46:20 UTC)"; version != expect {
+		t.Errorf("Expected bootloader version %q but got %q", expect, version)
+	}
+}
+
+func TestFirmwareInfo(t *testing.T) {
+	fs := NewMemFS()
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	if _, err := pi.FirmwareInfo(); err != ErrNoFirmwareInfo {
+		t.Errorf("Expected ErrNoFirmwareInfo but got %v", err)
+	}
+
+	// there is no bootloader on a Pi 3, which leaves the other details
+	fs.AddFile(filepath.Join(sys_dtsystem, "linux,revision"), []byte{0x00, 0xa2, 0x20, 0x82})
+	fs.AddFile(filepath.Join(sys_dtsystem, "linux,serial"), []byte{0, 0, 0, 0, 0x02, 0xdb, 0x14, 0x91})
+	fs.AddFile(filepath.Join(sys_dtchosen, "bootargs"), []byte("coherent_pool=1M console=tty1 root=/dev/mmcblk0p2\x00"))
+	fw, err := pi.FirmwareInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := FirmwareInfo{Revision: "a22082", Serial: "0000000002db1491", BootArgs: "coherent_pool=1M console=tty1 root=/dev/mmcblk0p2"}
+	if fw != expect {
+		t.Errorf("Expected firmware %+v but got %+v", expect, fw)
+	}
+}
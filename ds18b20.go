@@ -0,0 +1,129 @@
+package gopisysfs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 1-Wire devices, as the w1_therm driver presents them, see https://www.kernel.org/doc/html/latest/w1/slaves/w1_therm.html
+const (
+	sys_w1 = "sys/bus/w1/devices"
+	// ds18b20Family is the 1-Wire family code of the DS18B20, the prefix of its device names
+	ds18b20Family = "28-"
+	w1BusMaster   = "w1_bus_master"
+	// DS18B20Conversion is the time a DS18B20 takes to convert a temperature at its default 12-bit resolution.
+	// Lower resolutions halve it for each bit: 375ms at 11 bits, down to 94ms at 9 bits.
+	DS18B20Conversion = 750 * time.Millisecond
+)
+
+// ErrW1CRC is returned when a 1-Wire device's data does not match its CRC, which is usually a wiring or pull-up problem
+var ErrW1CRC = errors.New("1-Wire data failed the CRC check")
+
+// DS18B20 is a 1-Wire temperature sensor on the w1-gpio bus (enable the w1-gpio overlay)
+type DS18B20 struct {
+	// ID is the device name, like 28-0316a2795aff
+	ID string
+}
+
+// DS18B20s lists the DS18B20 sensors on the 1-Wire buses, in ID order
+func DS18B20s() ([]DS18B20, error) {
+	nodes, err := filesystem.ReadDir(file(sys_w1))
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, f := range nodes {
+		if strings.HasPrefix(f.Name(), ds18b20Family) {
+			ids = append(ids, f.Name())
+		}
+	}
+	sort.Strings(ids)
+	sensors := make([]DS18B20, len(ids))
+	for i, id := range ids {
+		sensors[i] = DS18B20{ID: id}
+	}
+	return sensors, nil
+}
+
+// ReadTemperature reads the sensor. The driver converts a temperature for the read, which takes up to
+// DS18B20Conversion, unless a conversion was triggered for all the sensors with ReadTemperatureFresh.
+// A read that fails the CRC check returns ErrW1CRC.
+func (d DS18B20) ReadTemperature() (Celsius, error) {
+	name := file(sys_w1, d.ID, "w1_slave")
+	data, err := readFile(name)
+	if err != nil {
+		return 0, err
+	}
+	return parseW1Slave(data)
+}
+
+// ReadTemperatureFresh starts a new conversion on every sensor of the buses, waits the conversion time (0 for
+// DS18B20Conversion, or less for a sensor set to a lower resolution), and then reads the sensor. Kernels without
+// bulk conversions (before 5.10) convert for each read anyway, so it is a plain ReadTemperature on those.
+func (d DS18B20) ReadTemperatureFresh(conversion time.Duration) (Celsius, error) {
+	if conversion < 0 {
+		return 0, fmt.Errorf("1-Wire %v conversion time %v can not be negative", d.ID, conversion)
+	}
+	if conversion == 0 {
+		conversion = DS18B20Conversion
+	}
+	triggered, err := triggerW1Conversion()
+	if err != nil {
+		return 0, err
+	}
+	if triggered {
+		time.Sleep(conversion)
+	}
+	return d.ReadTemperature()
+}
+
+// triggerW1Conversion starts a bulk temperature conversion on each bus master, and returns false if none supports it
+func triggerW1Conversion() (bool, error) {
+	nodes, err := filesystem.ReadDir(file(sys_w1))
+	if err != nil {
+		return false, err
+	}
+	triggered := false
+	for _, f := range nodes {
+		if !strings.HasPrefix(f.Name(), w1BusMaster) {
+			continue
+		}
+		bulk := file(sys_w1, f.Name(), "therm_bulk_read")
+		if !checkFile(bulk) {
+			continue
+		}
+		if err := writeFile(bulk, "trigger"); err != nil {
+			return false, fmt.Errorf("Unable to start a 1-Wire conversion on %v: %v", f.Name(), err)
+		}
+		triggered = true
+	}
+	return triggered, nil
+}
+
+// parseW1Slave reads the temperature from the w1_slave listing, which has the raw data with the CRC result, and the
+// data again with the temperature in millidegrees:
+//
+//	72 01 4b 46 7f ff 0e 10 57 : crc=57 YES
+//	72 01 4b 46 7f ff 0e 10 57 t=23125
+func parseW1Slave(data string) (Celsius, error) {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	if len(lines) != 2 {
+		return 0, fmt.Errorf("1-Wire data %q is not recognized", data)
+	}
+	if !strings.HasSuffix(strings.TrimSpace(lines[0]), "YES") {
+		return 0, ErrW1CRC
+	}
+	eq := strings.LastIndex(lines[1], "t=")
+	if eq < 0 {
+		return 0, fmt.Errorf("1-Wire data %q has no temperature", data)
+	}
+	milli, err := strconv.Atoi(strings.TrimSpace(lines[1][eq+2:]))
+	if err != nil {
+		return 0, fmt.Errorf("1-Wire temperature in %q is not recognized: %v", data, err)
+	}
+	return Celsius(milli) / 1000, nil
+}
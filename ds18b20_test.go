@@ -0,0 +1,39 @@
+package gopisysfs
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDS18B20(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddFile(filepath.Join(sys_w1, "28-0316a2795aff", "w1_slave"),
+		[]byte("72 01 4b 46 7f ff 0e 10 57 : crc=57 YES\n72 01 4b 46 7f ff 0e 10 57 t=23125\n"))
+	fs.AddFile(filepath.Join(sys_w1, "28-00000a1b2c3d", "w1_slave"),
+		[]byte("72 01 4b 46 7f ff 0e 10 57 : crc=00 NO\n72 01 4b 46 7f ff 0e 10 57 t=23125\n"))
+	fs.AddFile(filepath.Join(sys_w1, "w1_bus_master1", "therm_bulk_read"), []byte("0\n"))
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	sensors, err := DS18B20s()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sensors) != 2 || sensors[0].ID != "28-00000a1b2c3d" || sensors[1].ID != "28-0316a2795aff" {
+		t.Fatalf("Expected 2 sensors in ID order but got %v", sensors)
+	}
+	if _, err := sensors[0].ReadTemperature(); err != ErrW1CRC {
+		t.Errorf("Expected ErrW1CRC but got %v", err)
+	}
+	temp, err := sensors[1].ReadTemperatureFresh(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 23.125 {
+		t.Errorf("Expected 23.125C but got %v", temp)
+	}
+	if bulk, _ := readFile(file(sys_w1, "w1_bus_master1", "therm_bulk_read")); bulk != "trigger" {
+		t.Errorf("Expected a bulk conversion to be triggered but got %q", bulk)
+	}
+}
@@ -0,0 +1,135 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// eventFanout shares a single monitor of both edges between the subscribers of a port, each with its own channel.
+// The monitor is stopped when the last subscriber unsubscribes.
+type eventFanout struct {
+	mu   sync.Mutex
+	stop func()
+	subs map[chan Event]bool
+	// last is the most recent event, sent to new subscribers as their initial value
+	last *Event
+}
+
+// add creates a subscriber channel with the buffer depth
+func (f *eventFanout) add(buffer int) chan Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ch := make(chan Event, buffer)
+	if f.last != nil {
+		initial := *f.last
+		initial.Baseline = true
+		ch <- initial
+	}
+	f.subs[ch] = true
+	return ch
+}
+
+// remove closes the subscriber channel, and returns true if it was the last one
+func (f *eventFanout) remove(ch chan Event) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.subs[ch] {
+		return false
+	}
+	delete(f.subs, ch)
+	close(ch)
+	return len(f.subs) == 0
+}
+
+// send delivers the event to every subscriber, dropping it for those that are too slow
+func (f *eventFanout) send(event Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.last = &event
+	for ch := range f.subs {
+		select {
+		case ch <- event:
+		default:
+			warn("GPIO Subscriber dropped event %v: receive channel overflow\n", &event)
+		}
+	}
+}
+
+// closeAll closes the channels of the remaining subscribers
+func (f *eventFanout) closeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.subs {
+		close(ch)
+	}
+	f.subs = map[chan Event]bool{}
+}
+
+// Subscribe monitors the port for changes on both edges, like Values, but all the subscribers of a port share a
+// single monitor, so it is safe to subscribe from several goroutines. Each subscriber has its own channel with the
+// buffer depth (0 for DefaultWatchBuffer), and the first event is the latest value. The channel is closed when the
+// returned unsubscribe function is called, or when the port is reset. The monitor stops with the last subscriber.
+func (p *gport) Subscribe(buffersize int) (<-chan Event, func(), error) {
+	defer p.unlock(p.lock())
+
+	return p.subscribe(buffersize)
+}
+
+// subscribe adds a subscriber to the port's fanout, starting it if needed, and needs to be called with the port locked
+func (p *gport) subscribe(buffersize int) (<-chan Event, func(), error) {
+	if buffersize < 0 {
+		return nil, nil, fmt.Errorf("GPIO %v subscriber buffer %v can not be negative", p.port, buffersize)
+	}
+	if buffersize == 0 {
+		buffersize = DefaultWatchBuffer
+	}
+
+	if p.fanout == nil {
+		events, stop, err := p.watch(WatchConfig{Edge: GPIOEdgeBoth})
+		if err != nil {
+			return nil, nil, err
+		}
+		fan := &eventFanout{stop: stop, subs: map[chan Event]bool{}}
+		p.fanout = fan
+
+		done := startBackground(stop)
+		go func() {
+			defer done()
+			for event := range events {
+				fan.send(event)
+			}
+			// stopped by the last subscriber, or the port is reset
+			fan.closeAll()
+			p.dropFanout(fan)
+		}()
+	}
+
+	fan := p.fanout
+	ch := fan.add(buffersize)
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			defer p.unlock(p.lock())
+			if fan.remove(ch) {
+				if p.fanout == fan {
+					p.fanout = nil
+				}
+				fan.stop()
+			}
+		})
+	}
+	return ch, unsubscribe, nil
+}
+
+// dropFanout forgets the fanout if it is still the port's one
+func (p *gport) dropFanout(fan *eventFanout) {
+	defer p.unlock(p.lock())
+
+	if p.fanout == fan {
+		p.fanout = nil
+	}
+}
@@ -0,0 +1,57 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+	defer Shutdown()
+
+	first, unsubfirst, err := port.Subscribe(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-first; !event.Value {
+		t.Errorf("Expected the initial value to be true")
+	}
+	fan := port.(*gport).fanout
+
+	// a later subscriber shares the monitor, and gets the latest value
+	second, unsubsecond, err := port.Subscribe(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port.(*gport).fanout != fan {
+		t.Errorf("Expected the subscribers to share the monitor")
+	}
+	if event := <-second; !event.Value {
+		t.Errorf("Expected the latest value to be true")
+	}
+
+	unsubfirst()
+	unsubfirst()
+	if _, ok := <-first; ok {
+		t.Errorf("Expected the first channel to be closed")
+	}
+	select {
+	case event, ok := <-second:
+		t.Errorf("Expected the second subscriber to be unaffected, but got %v (open %v)", event, ok)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	unsubsecond()
+	if _, ok := <-second; ok {
+		t.Errorf("Expected the second channel to be closed")
+	}
+	if port.(*gport).fanout != nil {
+		t.Errorf("Expected the monitor to stop with the last subscriber")
+	}
+}
@@ -1,10 +1,13 @@
 package gopisysfs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -18,6 +21,10 @@ type GPIOMode int
 const (
 	GPIOInput GPIOMode = iota
 	GPIOOutput
+	// GPIOOutputLow and GPIOOutputHigh make the port an output with the value in a single write, so the pin never
+	// drives the wrong level. The value is only set like this when the port changes to an output. SetMode on a port
+	// that is already an output writes the level to the value file instead, like a SetValue (that respects
+	// active_low), so the direction is not rewritten and the pin does not glitch.
 	GPIOOutputLow
 	GPIOOutputHigh
 
@@ -32,28 +39,185 @@ const (
 
 	low  = "0"
 	high = "1"
+
+	// DefaultWatchBuffer is the channel buffer depth used when a watch does not specify one
+	DefaultWatchBuffer = 16
+	// DefaultPollTimeout is the longest a monitor waits for an edge when a watch does not specify it
+	DefaultPollTimeout = 500 * time.Millisecond
+	// EdgelessPollInterval is how often a monitor reads the value of a port that can not interrupt (see
+	// SupportsInterrupts), which is the latency of its events
+	EdgelessPollInterval = 10 * time.Millisecond
 )
 
+type GPIOEdge int
+
+const (
+	GPIOEdgeNone GPIOEdge = iota
+	GPIOEdgeRising
+	GPIOEdgeFalling
+	GPIOEdgeBoth
+
+	edge_none    = "none"
+	edge_rising  = "rising"
+	edge_falling = "falling"
+	edge_both    = "both"
+)
+
+// String returns the sysfs direction name for the mode
+func (m GPIOMode) String() string {
+	switch m {
+	case GPIOInput:
+		return direction_in
+	case GPIOOutput:
+		return direction_out
+	case GPIOOutputLow:
+		return direction_outlow
+	case GPIOOutputHigh:
+		return direction_outhi
+	}
+	return fmt.Sprintf("GPIOMode(%d)", int(m))
+}
+
+// String returns the sysfs edge name for the edge
+func (e GPIOEdge) String() string {
+	switch e {
+	case GPIOEdgeNone:
+		return edge_none
+	case GPIOEdgeRising:
+		return edge_rising
+	case GPIOEdgeFalling:
+		return edge_falling
+	case GPIOEdgeBoth:
+		return edge_both
+	}
+	return fmt.Sprintf("GPIOEdge(%d)", int(e))
+}
+
+// MarshalText encodes the mode as its sysfs direction name, like "in" or "high", for JSON and other text formats
+func (m GPIOMode) MarshalText() ([]byte, error) {
+	if m < GPIOInput || m > GPIOOutputHigh {
+		return nil, fmt.Errorf("GPIOMode %d does not exist", int(m))
+	}
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText decodes a sysfs direction name, as encoded by MarshalText
+func (m *GPIOMode) UnmarshalText(text []byte) error {
+	for mode := GPIOInput; mode <= GPIOOutputHigh; mode++ {
+		if string(text) == mode.String() {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("GPIOMode %q is not recognized", text)
+}
+
+// MarshalText encodes the edge as its sysfs edge name, like "rising", for JSON and other text formats
+func (e GPIOEdge) MarshalText() ([]byte, error) {
+	if e < GPIOEdgeNone || e > GPIOEdgeBoth {
+		return nil, fmt.Errorf("GPIOEdge %d does not exist", int(e))
+	}
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText decodes a sysfs edge name, as encoded by MarshalText
+func (e *GPIOEdge) UnmarshalText(text []byte) error {
+	edge, err := parseEdge(string(text))
+	if err != nil {
+		return err
+	}
+	*e = edge
+	return nil
+}
+
+// PortState is a machine-readable snapshot of a port's configuration and value
+type PortState struct {
+	Enabled bool
+	// Direction is GPIOInput or GPIOOutput (sysfs does not retain the initial level of an output)
+	Direction GPIOMode
+	Value     bool
+	Edge      GPIOEdge
+	ActiveLow bool
+}
+
 type Event struct {
 	Value     bool
 	Timestamp time.Time
+	// Previous is the value of the last event sent on the channel, and Dwell is how long before this event that was.
+	// For the first event, Previous is the same as Value and Dwell is 0.
+	Previous bool
+	Dwell    time.Duration
+	// Baseline is true for the first event of a watch, which is the value read as the watch starts, not a transition,
+	// and its Timestamp is when it was read. The first event of a Subscribe is the latest value, also as a Baseline.
+	Baseline bool
 }
 
 func (e *Event) String() string {
+	if e.Baseline {
+		return fmt.Sprintf("%v at %v (baseline)", e.Value, e.Timestamp)
+	}
 	return fmt.Sprintf("%v at %v", e.Value, e.Timestamp)
 }
 
+// WatchConfig configures how an input port's value is monitored by GPIOPort.Watch
+type WatchConfig struct {
+	// Edge selects the transitions that produce events. GPIOEdgeNone is treated as GPIOEdgeBoth. The port signals
+	// both edges while it is watched, and each watch filters its own, so watches with different edges can share a port.
+	Edge GPIOEdge
+	// Buffer is the depth of the returned channel's buffer, or 0 for DefaultWatchBuffer.
+	// Events are only queued while the consumer is not receiving, so a deeper buffer costs a little memory,
+	// but tolerates a consumer that lags behind bursts of edges for longer before events are lost.
+	Buffer int
+	// Debounce, if positive, suppresses events for the duration after each reported event. Once that time passes
+	// the settled value is read, and reported if it is different to the last reported value.
+	Debounce time.Duration
+	// SendTimeout is how long to wait for space in a full channel before dropping an event. A consumer that is
+	// too slow loses events, but the watch keeps running. The default of 0 drops events immediately.
+	SendTimeout time.Duration
+	// PollTimeout is the longest the monitor waits for an edge before waking to check whether it has been stopped,
+	// or 0 for DefaultPollTimeout. Edges are reported as they happen regardless, so a shorter timeout only makes the
+	// monitor stop sooner, at the cost of waking more often while the port is idle.
+	PollTimeout time.Duration
+	// Replay sends the events retained by the port's history (see SetEventHistory) before the live events, oldest
+	// first. Only as many as fit in the Buffer, leaving space for the current value, are replayed.
+	Replay bool
+	// SkipBaseline leaves out the Baseline event with the value when the watch starts, so that only transitions
+	// are reported. The baseline is still the Previous value of the first transition.
+	SkipBaseline bool
+}
+
 type GPIOPort interface {
+	Host() Pi
 	State() string
+	Snapshot() (PortState, error)
 	IsEnabled() bool
 	Enable() error
 	Reset() error
+	ResetContext(ctx context.Context) error
 	SetMode(GPIOMode) error
+	Mode() (GPIOMode, error)
 	IsOutput() (bool, error)
+	SupportsInterrupts() (bool, error)
 	SetValue(bool) error
+	SetValueIfChanged(bool) (bool, error)
 	SetValues(ch <-chan bool) (<-chan error, error)
 	Value() (bool, error)
+	WaitForValue(level bool, timeout time.Duration) error
 	Values(buffersize int) (<-chan Event, error)
+	Subscribe(buffersize int) (<-chan Event, func(), error)
+	Watch(cfg WatchConfig) (<-chan Event, func(), error)
+	OnChange(callback func(Event)) (func(), error)
+	WatchUntil(ctx context.Context, edge GPIOEdge, handler func(Event)) error
+	CountStream(edge GPIOEdge, emitEvery time.Duration) (<-chan uint64, func(), error)
+	SetTrusted(trusted bool)
+	Refresh() error
+	SetKeepExported(keep bool)
+	SetMinSwitchInterval(d time.Duration, block bool)
+	SetPermissionRetry(timeout time.Duration)
+	SetSafeState(level bool)
+	ClearSafeState()
+	SetEventHistory(size int) error
+	Metrics() PortMetrics
 }
 
 type gport struct {
@@ -65,9 +229,41 @@ type gport struct {
 	value     string
 	direction string
 	edge      string
+	activelow string
 	export    string
 	unexport  string
-	resetters []func()
+	// resetters stop the monitors and SetValues of the port when it is reset, keyed so that each can remove itself
+	// when it is stopped first. They have their own lock, as a stop can be called with the port locked, or not.
+	resetmu   sync.Mutex
+	resetters map[int]func()
+	resetid   int
+	// trusted ports cache the direction and output value that were last written (or refreshed), empty if unknown
+	trusted  bool
+	cachedir string
+	cacheval string
+	// kept ports are not reset automatically, see SetKeepExported
+	kept bool
+	// the minimum time between SetValue switches, and the last value switched to and when
+	minswitch   time.Duration
+	blockswitch bool
+	lastval     string
+	lastswitch  time.Time
+	// the recent events of the port's monitors, nil unless SetEventHistory is used
+	history *eventHistory
+	// the debounce of watches that do not specify one, see InputSpec
+	debounce time.Duration
+	metrics  *portCounters
+	// the monitor shared by the subscribers, nil if there are none
+	fanout *eventFanout
+	// the mode last set with SetMode, as the kernel reads "low" and "high" back as "out", -1 if unknown
+	lastmode GPIOMode
+	// how long writes are retried while access is denied, see SetPermissionRetry
+	permretry time.Duration
+	// the value that the port is driven to when it is reset, if hassafe is set, see SetSafeState
+	hassafe   bool
+	safestate bool
+	// the value file, kept open for repeated reads, nil until the value is read
+	valuef *os.File
 }
 
 func newGPIO(host *pi, port int) *gport {
@@ -87,9 +283,12 @@ func newGPIO(host *pi, port int) *gport {
 		value:     filepath.Join(folder, "value"),
 		direction: filepath.Join(folder, "direction"),
 		edge:      filepath.Join(folder, "edge"),
+		activelow: filepath.Join(folder, "active_low"),
 		export:    export,
 		unexport:  unexport,
-		resetters: make([]func(), 0),
+		resetters: make(map[int]func()),
+		metrics:   &portCounters{},
+		lastmode:  -1,
 	}
 }
 
@@ -97,6 +296,11 @@ func (p *gport) String() string {
 	return p.folder
 }
 
+// Host returns the Pi that the port belongs to, for its header mappings and sibling ports
+func (p *gport) Host() Pi {
+	return p.host
+}
+
 func (p *gport) IsEnabled() bool {
 
 	defer p.unlock(p.lock())
@@ -104,6 +308,9 @@ func (p *gport) IsEnabled() bool {
 	return checkFile(p.folder)
 }
 
+// Enable exports the port, and waits (up to the timelimit) for sysfs to create the port folder and control files.
+// A port that is already exported, by this or another process, is used as it is, and not exported again.
+// The time the export took is logged at the info level. The export is written and synced before waiting (see writeFileSync).
 func (p *gport) Enable() error {
 
 	defer p.unlock(p.lock())
@@ -114,14 +321,23 @@ func (p *gport) Enable() error {
 
 	info("GPIO Enabling %v\n", p)
 
-	if err := writeFile(p.export, p.sport); err != nil {
-		return err
+	if err := writeFileSync(p.export, p.sport); err != nil {
+		if !isBusy(err) {
+			return err
+		}
+		// a driver that owns the pin makes the export busy too, which is worth explaining
+		if claimed, owner, cerr := IsPinClaimed(p.port); cerr == nil && claimed && owner != "sysfs" {
+			return fmt.Errorf("GPIO %v is owned by %v: %v", p.port, owner, err)
+		}
+		// another process exported it since we checked
+		debug("GPIO Enabling %v already exported: %v\n", p, err)
 	}
+	p.invalidate()
 
 	start := time.Now()
 
 	// wait for folder to arrive....
-	ch, err := awaitFileCreate(p.folder, timelimit)
+	ch, err := awaitFileCreateCtx(context.Background(), p.folder, timelimit)
 	if err != nil {
 		return err
 	}
@@ -134,21 +350,27 @@ func (p *gport) Enable() error {
 	// don't check value ... it can give "operation not permitted" error for an input GPIO when the
 	// write is made - go can interpret that as a permissions error
 	for _, fname := range []string{p.direction, p.edge} {
+		if fname == p.edge && !checkFile(fname) {
+			// sysfs creates the control files together, and only creates edge for ports that can interrupt.
+			debug("GPIO Enabling %v has no edge file, its value is polled when watched\n", p)
+			break
+		}
 		for {
 			remaining := timelimit - time.Since(start)
-			info("GPIO Enabling %v checking file %v state (timeout limit %v)\n", p, fname, remaining)
+			debug("GPIO Enabling %v checking file %v state (timeout limit %v)\n", p, fname, remaining)
 			if checkFile(fname) {
 				// exists, but check writable.... invalid data will be ignored(rejected), but permissions won't
 				if err := writeFile(fname, " "); err == nil || !os.IsPermission(err) {
-					info("GPIO Enabling %v file %v state OK\n", p, fname)
+					debug("GPIO Enabling %v file %v state OK\n", p, fname)
 					break
 				} else {
-					info("GPIO Enabling %v file %v state %v\n", p, fname, err)
+					debug("GPIO Enabling %v file %v state %v\n", p, fname, err)
 				}
 			}
 			remaining = timelimit - time.Since(start)
 			select {
 			case <-time.After(remaining):
+				errorf("GPIO Enabling %v timed out waiting for %v\n", p, fname)
 				return fmt.Errorf("Timed out enabling GPIO %v - %v not yet writable", p.sport, fname)
 			case <-time.After(pollInterval):
 				// next cycle
@@ -157,12 +379,21 @@ func (p *gport) Enable() error {
 
 	}
 
-	info("GPIO Enabled %v\n", p)
+	// the time taken shows how close the export came to the limit, on slow systems it can be hundreds of ms
+	info("GPIO Enabled %v in %v (limit %v)\n", p, time.Since(start), timelimit)
 
 	return nil
 }
 
+// Reset unexports the port, and waits (up to the timelimit) for sysfs to remove the port folder.
+// The unexport is written and synced before waiting, like the export in Enable.
 func (p *gport) Reset() error {
+	return p.ResetContext(context.Background())
+}
+
+// ResetContext unexports the port like Reset, but stops waiting for sysfs to remove the
+// port folder if the context is cancelled first, returning the context's error.
+func (p *gport) ResetContext(ctx context.Context) error {
 
 	defer p.unlock(p.lock())
 
@@ -171,21 +402,32 @@ func (p *gport) Reset() error {
 		return nil
 	}
 	info("GPIO Resetting  %v\n", p)
-	for _, r := range p.resetters {
-		// call the reset function
-		r()
+	p.runResetters()
+	p.invalidate()
+	p.history.clear()
+	p.lastmode = -1
+	p.closeValue()
+
+	if p.hassafe {
+		// the port stays an output at the safe level after it is unexported
+		if err := p.driveSafeState(); err != nil {
+			errorf("GPIO Reset %v unable to drive the safe state %v: %v\n", p, p.safestate, err)
+			return fmt.Errorf("GPIO %v was not reset, it could not be driven to the safe state %v: %v", p.port, p.safestate, err)
+		}
+		info("GPIO Reset %v driven to the safe state %v\n", p, p.safestate)
 	}
-	p.resetters = nil
 
-	if err := writeFile(p.unexport, p.sport); err != nil {
+	if err := writeFileSync(p.unexport, p.sport); err != nil {
 		return err
 	}
-	ch, err := awaitFileRemove(p.folder, timelimit)
+	ch, err := awaitFileRemoveCtx(ctx, p.folder, timelimit)
 	if err != nil {
 		return err
 	}
-
 	if err := <-ch; err != nil {
+		if err == ctx.Err() {
+			warn("GPIO Reset  %v abandoned: %v\n", p, err)
+		}
 		return err
 	}
 
@@ -218,18 +460,88 @@ func (p *gport) SetMode(mode GPIOMode) error {
 	case GPIOOutputLow:
 		direction = direction_outlow
 	default:
-		return fmt.Errorf("GPIOMode %v does not exist")
+		return fmt.Errorf("GPIOMode %v does not exist", mode)
 	}
 
-	info("GPIO Setting mode on  %v to %v\n", p, direction)
+	debug("GPIO Setting mode on  %v to %v\n", p, direction)
+
+	if mode == GPIOOutputLow || mode == GPIOOutputHigh {
+		routed, err := p.setOutputLevel(mode == GPIOOutputHigh)
+		if err != nil {
+			p.lastmode = -1
+			return err
+		}
+		if routed {
+			p.lastmode = mode
+			info("GPIO Set mode on  %v to %v (through the value)\n", p, direction)
+			return nil
+		}
+	}
 
 	if err := p.writeDirection(direction); err != nil {
+		p.lastmode = -1
 		return err
 	}
+	p.lastmode = mode
 	info("GPIO Set mode on  %v to %v\n", p, direction)
 	return nil
 }
 
+// setOutputLevel sets the level of a port that is already an output through its value, and returns false, without
+// writing anything, if it is not an output. Rewriting the direction of an output can glitch the pin, as the kernel
+// may reconfigure it on the way. The direction's "high" and "low" are the raw level, but the value is inverted by
+// active_low, so the value is inverted too. Like the direction, the write is not limited by SetMinSwitchInterval,
+// but it counts as a switch for later SetValues. It needs to be called with the port locked.
+func (p *gport) setOutputLevel(level bool) (bool, error) {
+	direction, err := p.readDirection()
+	if err != nil || direction != direction_out {
+		return false, nil
+	}
+	activelow, err := readFile(p.activelow)
+	if err != nil {
+		// the inversion is unknown, so the direction has to be written after all
+		return false, nil
+	}
+	val := low
+	if level != (activelow == high) {
+		val = high
+	}
+	if err := p.writeValue(val); err != nil {
+		return true, err
+	}
+	if val != p.lastval {
+		p.lastval = val
+		p.lastswitch = time.Now()
+	}
+	return true, nil
+}
+
+// Mode returns the port's mode. The kernel reads the direction back as "out" after SetMode(GPIOOutputLow) or
+// SetMode(GPIOOutputHigh), so for an output that was last set to one of those, the initial level is taken from that
+// SetMode, and the mode is GPIOOutputLow or GPIOOutputHigh. That initial level is not the current value, which
+// SetValue changes. Otherwise, and if the direction changed since, the mode is GPIOInput or GPIOOutput from the file.
+func (p *gport) Mode() (GPIOMode, error) {
+
+	defer p.unlock(p.lock())
+
+	err := p.checkEnabled()
+	if err != nil {
+		return GPIOInput, err
+	}
+	d, err := p.readDirection()
+	if err != nil {
+		return GPIOInput, err
+	}
+	mode, err := parseDirection(d)
+	if err != nil {
+		return GPIOInput, err
+	}
+	if mode == GPIOOutput && (p.lastmode == GPIOOutputLow || p.lastmode == GPIOOutputHigh) {
+		return p.lastmode, nil
+	}
+	return mode, nil
+}
+
 func (p *gport) IsOutput() (bool, error) {
 
 	defer p.unlock(p.lock())
@@ -245,25 +557,98 @@ func (p *gport) IsOutput() (bool, error) {
 	return d != "in", nil
 }
 
-func (p *gport) State() string {
+// SupportsInterrupts returns true if the port can signal edges, which needs an edge file that can be written.
+// Otherwise the monitor of Watch (and Values etc.) polls the value every EdgelessPollInterval instead, which adds
+// that much latency to the events, and misses pulses that are shorter. An alternative FileSystem never interrupts.
+func (p *gport) SupportsInterrupts() (bool, error) {
 
 	defer p.unlock(p.lock())
 
+	err := p.checkEnabled()
+	if err != nil {
+		return false, err
+	}
+	return p.supportsInterrupts()
+}
+
+// supportsInterrupts checks the edge file can be written, by writing back the current edge, and needs to be called
+// with the port locked
+func (p *gport) supportsInterrupts() (bool, error) {
+	if !isOSFileSystem() || !checkFile(p.edge) {
+		return false, nil
+	}
+	edge, err := p.readEdge()
+	if err != nil {
+		return false, err
+	}
+	if err := p.writeEdge(edge); err != nil {
+		if os.IsPermission(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// State returns a human readable description of the port's state, see Snapshot for a machine-readable one
+func (p *gport) State() string {
+
 	base := fmt.Sprintf("GPIO %v: ", p.sport)
-	if !checkFile(p.folder) {
+
+	state, err := p.Snapshot()
+	if err != nil {
+		return fmt.Sprintf("%v%v", base, err)
+	}
+	if !state.Enabled {
 		return base + "Reset"
 	}
 
+	return fmt.Sprintf("%v %v with value %v (edge %v, active low %v)", base, state.Direction, state.Value, state.Edge, state.ActiveLow)
+}
+
+// Snapshot reads the port's current configuration and value. Only the Enabled field is set if the port is not enabled.
+func (p *gport) Snapshot() (PortState, error) {
+
+	defer p.unlock(p.lock())
+
+	state := PortState{}
+	if !checkFile(p.folder) {
+		return state, nil
+	}
+	state.Enabled = true
+
 	dir, err := p.readDirection()
 	if err != nil {
-		return fmt.Sprintf("%v%v", base, err)
+		return state, err
 	}
+	if state.Direction, err = parseDirection(dir); err != nil {
+		return state, err
+	}
+
 	val, err := p.readValue()
 	if err != nil {
-		return fmt.Sprintf("%v%v", base, err)
+		return state, err
+	}
+	state.Value = val == high
+
+	// ports that can't interrupt have no edge file, and no edges
+	if checkFile(p.edge) {
+		edge, err := p.readEdge()
+		if err != nil {
+			return state, err
+		}
+		if state.Edge, err = parseEdge(edge); err != nil {
+			return state, err
+		}
+	}
+
+	activelow, err := readFile(p.activelow)
+	if err != nil {
+		return state, err
 	}
+	state.ActiveLow = activelow == high
 
-	return fmt.Sprintf("%v %v with value %v", base, dir, val)
+	return state, nil
 }
 
 func (p *gport) Value() (bool, error) {
@@ -283,6 +668,95 @@ func (p *gport) Value() (bool, error) {
 	return d == "1", nil
 }
 
+// WaitForValue returns when the port's value equals the level, or returns an error if the timeout elapses first.
+// It returns immediately if the value is already at the level. If the port can interrupt (see SupportsInterrupts), the
+// wait subscribes to the port's shared monitor, as Subscribe does, starting it if the port is not monitored already.
+// Otherwise the value is polled.
+func (p *gport) WaitForValue(level bool, timeout time.Duration) error {
+
+	reached, ch, stop, err := p.watchForValue(level)
+	if err != nil {
+		return err
+	}
+	if reached {
+		return nil
+	}
+
+	tout := time.NewTimer(timeout)
+	defer tout.Stop()
+
+	if ch == nil {
+		// naieve polling system
+		interval := time.NewTicker(pollInterval)
+		defer interval.Stop()
+		for {
+			select {
+			case <-tout.C:
+				return fmt.Errorf("Timed out waiting for GPIO %v value %v after %v", p.port, level, timeout)
+			case <-interval.C:
+			}
+			val, err := p.Value()
+			if err != nil {
+				return err
+			}
+			if val == level {
+				return nil
+			}
+		}
+	}
+
+	defer stop()
+	for {
+		select {
+		case <-tout.C:
+			return fmt.Errorf("Timed out waiting for GPIO %v value %v after %v", p.port, level, timeout)
+		case event, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("GPIO %v monitor closed while waiting for value %v", p.port, level)
+			}
+			if event.Value == level {
+				return nil
+			}
+		}
+	}
+}
+
+// watchForValue returns true if the port is at the level, otherwise it subscribes to the port's shared monitor, if
+// it has one or the port can interrupt. The returned channel is nil if the port can only be polled.
+func (p *gport) watchForValue(level bool) (bool, <-chan Event, func(), error) {
+
+	defer p.unlock(p.lock())
+
+	err := p.checkEnabled()
+	if err != nil {
+		return false, nil, nil, err
+	}
+
+	val, err := p.readValue()
+	if err != nil {
+		return false, nil, nil, err
+	}
+	if (val == high) == level {
+		return true, nil, nil, nil
+	}
+
+	if p.fanout == nil {
+		interrupts, err := p.supportsInterrupts()
+		if err != nil {
+			return false, nil, nil, err
+		}
+		if !interrupts {
+			debug("GPIO %v polling for value %v\n", p, level)
+			return false, nil, nil, nil
+		}
+	}
+	ch, unsubscribe, err := p.subscribe(0)
+	if err != nil {
+		return false, nil, nil, err
+	}
+	return false, ch, unsubscribe, nil
+}
+
 func (p *gport) SetValue(value bool) error {
 
 	defer p.unlock(p.lock())
@@ -292,15 +766,91 @@ func (p *gport) SetValue(value bool) error {
 		return err
 	}
 
-	info("GPIO Set Value on %v to %v\n", p, value)
+	debug("GPIO Set Value on %v to %v\n", p, value)
+
+	return p.setValue(value)
+}
+
+// SetValueIfChanged sets the value like SetValue, but only writes it if the port does not have the value already,
+// and returns true if it was written. On a trusted port (see SetTrusted) the current value comes from the cache, so
+// idempotent writes cost no system calls at all, but a change made by another process is only seen after a Refresh.
+// Otherwise the value is read from sysfs, which is always correct, but saves little over the write.
+func (p *gport) SetValueIfChanged(value bool) (bool, error) {
+
+	defer p.unlock(p.lock())
+
+	err := p.checkEnabled()
+	if err != nil {
+		return false, err
+	}
+
+	current, err := p.readValue()
+	if err != nil {
+		return false, err
+	}
+	if (current == high) == value {
+		return false, nil
+	}
+
+	debug("GPIO Set Value on %v to %v (changed)\n", p, value)
+
+	if err := p.setValue(value); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// setValue writes the value, respecting the minimum switch interval, and needs to be called with the port locked
+func (p *gport) setValue(value bool) error {
 
 	val := low
 	if value {
 		val = high
 	}
 
-	return p.writeValue(val)
+	if p.minswitch > 0 && p.lastval != "" && val != p.lastval {
+		if wait := p.minswitch - time.Since(p.lastswitch); wait > 0 {
+			if !p.blockswitch {
+				return &SwitchTooSoonError{Port: p.port, Wait: wait}
+			}
+			debug("GPIO Set Value on %v delayed %v\n", p, wait)
+			time.Sleep(wait)
+		}
+	}
+
+	if err := p.writeValue(val); err != nil {
+		return err
+	}
+	if val != p.lastval {
+		p.lastval = val
+		p.lastswitch = time.Now()
+	}
+	return nil
+
+}
 
+// SwitchTooSoonError is returned by SetValue when the port has a minimum switch interval that does not block,
+// and the value would switch before the interval has passed since the last switch.
+type SwitchTooSoonError struct {
+	Port int
+	// Wait is how much longer the switch has to be delayed
+	Wait time.Duration
+}
+
+func (e *SwitchTooSoonError) Error() string {
+	return fmt.Sprintf("GPIO %v can not switch for another %v", e.Port, e.Wait)
+}
+
+// SetMinSwitchInterval makes SetValue keep switches of the value at least d apart, to protect electromechanical
+// loads like relays. Setting the value it already has is not a switch. If block is true, a switch that is too soon
+// waits (holding the port) until the interval has passed, otherwise SetValue returns a *SwitchTooSoonError with the
+// remaining delay. Only SetValue (and SetValues) are limited, not the initial level in SetMode. A d of 0 removes the limit.
+func (p *gport) SetMinSwitchInterval(d time.Duration, block bool) {
+
+	defer p.unlock(p.lock())
+
+	p.minswitch = d
+	p.blockswitch = block
 }
 
 func (p *gport) SetValues(ch <-chan bool) (<-chan error, error) {
@@ -315,12 +865,16 @@ func (p *gport) SetValues(ch <-chan bool) (<-chan error, error) {
 
 	errch := make(chan error, 1)
 	killer := make(chan bool, 1)
+	var once sync.Once
 	cleaner := func() {
-		close(killer)
+		once.Do(func() { close(killer) })
 	}
-	p.resetters = append(p.resetters, cleaner)
+	remove := p.addResetter(cleaner)
+	done := startBackground(cleaner)
 
 	go func() {
+		defer done()
+		defer remove()
 		defer close(errch)
 		for {
 			select {
@@ -343,32 +897,246 @@ func (p *gport) SetValues(ch <-chan bool) (<-chan error, error) {
 
 }
 
+// Values monitors the port for changes on both edges, with a channel buffer of the given depth (see WatchConfig.Buffer).
+// The channel is closed when the port is reset. It is a Subscribe that never unsubscribes, so concurrent calls
+// share a single monitor of the port.
 func (p *gport) Values(buffersize int) (<-chan Event, error) {
 	defer p.unlock(p.lock())
 
+	ch, _, err := p.subscribe(buffersize)
+	return ch, err
+}
+
+// Watch monitors the port for changes as configured. The channel is closed when the returned stop function
+// is called, or when the port is reset.
+func (p *gport) Watch(cfg WatchConfig) (<-chan Event, func(), error) {
+	defer p.unlock(p.lock())
+
+	return p.watch(cfg)
+}
+
+// OnChange calls the callback for each change of the port's value (on both edges, and once for the initial value),
+// as an alternative to receiving from a Watch channel. The callbacks are made one at a time from a goroutine that the
+// library manages, and a panic in the callback is logged and does not stop the monitor. A slow callback makes the
+// monitor drop events, as with Watch. Call the returned function to stop, it is also stopped when the port is reset.
+func (p *gport) OnChange(callback func(Event)) (func(), error) {
+	ch, stop, err := p.Watch(WatchConfig{Edge: GPIOEdgeBoth})
+	if err != nil {
+		return nil, err
+	}
+
+	done := startBackground(stop)
+	go func() {
+		defer done()
+		for event := range ch {
+			p.callback(callback, event)
+		}
+	}()
+
+	return stop, nil
+}
+
+// WatchUntil calls the handler for each event of a Watch on the edge (and once for the initial value), from the
+// calling goroutine, until the context is done, and then stops the monitor and returns the context's error.
+// A slow handler makes the monitor drop events, as with Watch. If the monitor stops first, because the port is reset
+// or the monitor failed, WatchUntil returns an error saying so, which includes the monitor's error.
+func (p *gport) WatchUntil(ctx context.Context, edge GPIOEdge, handler func(Event)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ch, stop, failure, err := func() (<-chan Event, func(), func() error, error) {
+		defer p.unlock(p.lock())
+		return p.watchMonitor(WatchConfig{Edge: edge})
+	}()
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-ch:
+			if !ok {
+				if err := failure(); err != nil {
+					return fmt.Errorf("GPIO %v monitor failed: %v", p.port, err)
+				}
+				if !p.IsEnabled() {
+					return fmt.Errorf("GPIO %v was reset while it was watched", p.port)
+				}
+				return fmt.Errorf("GPIO %v monitor stopped unexpectedly", p.port)
+			}
+			handler(event)
+		}
+	}
+}
+
+// callback calls the OnChange callback, recovering from a panic in it
+func (p *gport) callback(callback func(Event), event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			errorf("GPIO %v change callback panicked on %v: %v\n", p, &event, r)
+		}
+	}()
+	callback(event)
+}
+
+// watch sets up a monitor on the port, and needs to be called with the port locked
+func (p *gport) watch(cfg WatchConfig) (<-chan Event, func(), error) {
+	ch, stop, _, err := p.watchMonitor(cfg)
+	return ch, stop, err
+}
+
+// watchMonitor is watch, but also returns a function that returns the error that terminated the monitor, once its
+// channel is closed
+func (p *gport) watchMonitor(cfg WatchConfig) (<-chan Event, func(), func() error, error) {
+
 	info("GPIO Setting Value channel on %v\n", p)
 
 	err := p.checkEnabled()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+	if cfg.Edge == GPIOEdgeNone {
+		cfg.Edge = GPIOEdgeBoth
+	}
+	if cfg.Buffer < 0 {
+		return nil, nil, nil, fmt.Errorf("GPIO %v watch buffer %v can not be negative", p.port, cfg.Buffer)
+	}
+	if cfg.Buffer == 0 {
+		cfg.Buffer = DefaultWatchBuffer
+	}
+	if cfg.PollTimeout < 0 {
+		return nil, nil, nil, fmt.Errorf("GPIO %v watch poll timeout %v can not be negative", p.port, cfg.PollTimeout)
+	}
+	if cfg.PollTimeout == 0 {
+		cfg.PollTimeout = DefaultPollTimeout
+	}
+	if cfg.Debounce == 0 {
+		cfg.Debounce = p.debounce
+	}
+	interrupts, err := p.supportsInterrupts()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if interrupts {
+		// the edge file is shared by every monitor of the port, so it signals both edges, and each monitor filters
+		// its own edge
+		err = p.writeEdge(edge_both)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	} else {
+		info("GPIO %v can not interrupt, polling the value every %v\n", p, EdgelessPollInterval)
 	}
 
-	err = p.writeEdge("both")
+	ch, cleaner, failure, err := buildMonitor(p.value, cfg, interrupts, p.history, p.metrics)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
+	}
+	remove := p.addResetter(cleaner)
+	stop := func() {
+		cleaner()
+		remove()
+	}
+
+	return ch, stop, failure, nil
+}
+
+// addResetter registers the function to be called when the port is reset or released, and returns a function that
+// unregisters it again, for a monitor or SetValues that ends first
+func (p *gport) addResetter(fn func()) func() {
+	p.resetmu.Lock()
+	defer p.resetmu.Unlock()
+
+	p.resetid++
+	id := p.resetid
+	p.resetters[id] = fn
+	return func() {
+		p.resetmu.Lock()
+		defer p.resetmu.Unlock()
+
+		delete(p.resetters, id)
+	}
+}
+
+// runResetters calls and unregisters all the resetters
+func (p *gport) runResetters() {
+	p.resetmu.Lock()
+	resetters := p.resetters
+	p.resetters = make(map[int]func())
+	p.resetmu.Unlock()
+
+	for _, r := range resetters {
+		r()
 	}
+}
+
+// setEdge configures the edges that the port signals
+func (p *gport) setEdge(edge GPIOEdge) error {
 
-	ch, cleaner, err := buildMonitor(p.value, buffersize)
+	defer p.unlock(p.lock())
+
+	err := p.checkEnabled()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if _, err := parseEdge(edge.String()); err != nil {
+		return err
 	}
-	p.resetters = append(p.resetters, cleaner)
+	if !checkFile(p.edge) {
+		if edge == GPIOEdgeNone {
+			return nil
+		}
+		return fmt.Errorf("GPIO %v can not signal edge %v, it has no edge file (the port can not interrupt)", p.port, edge)
+	}
+	return p.writeEdge(edge.String())
+}
+
+// setActiveLow inverts the port's values (in both directions) if activelow is true
+func (p *gport) setActiveLow(activelow bool) error {
 
-	return ch, nil
+	defer p.unlock(p.lock())
+
+	err := p.checkEnabled()
+	if err != nil {
+		return err
+	}
+	val := low
+	if activelow {
+		val = high
+	}
+	// a cached output value is inverted too
+	p.invalidate()
+	return p.writeAttr(p.activelow, val)
+}
+
+// setDebounce sets the debounce of watches that do not specify one
+func (p *gport) setDebounce(debounce time.Duration) {
+
+	defer p.unlock(p.lock())
+
+	p.debounce = debounce
+}
+
+// writeAttr writes a control file of the port, retrying while access is denied for up to the permission retry timeout
+func (p *gport) writeAttr(name, text string) error {
+	err := writeFile(name, text)
+	if p.permretry <= 0 || !isDenied(err) {
+		return err
+	}
+	deadline := time.Now().Add(p.permretry)
+	for isDenied(err) && time.Now().Before(deadline) {
+		debug("GPIO %v write to %v denied, retrying: %v\n", p, name, err)
+		time.Sleep(pollInterval)
+		err = writeFile(name, text)
+	}
+	return err
 }
 
 func (p *gport) writeEdge(edges string) error {
-	return writeFile(p.edge, edges)
+	return p.writeAttr(p.edge, edges)
 }
 
 func (p *gport) readEdge() (string, error) {
@@ -376,19 +1144,291 @@ func (p *gport) readEdge() (string, error) {
 }
 
 func (p *gport) writeDirection(direction string) error {
-	return writeFile(p.direction, direction)
+	err := p.writeAttr(p.direction, direction)
+	p.metrics.write(err)
+	if err != nil {
+		p.invalidate()
+		return err
+	}
+	switch direction {
+	case direction_outlow:
+		p.cachedir, p.cacheval = direction_out, low
+	case direction_outhi:
+		p.cachedir, p.cacheval = direction_out, high
+	case direction_out:
+		p.cachedir = direction_out
+	default:
+		// inputs change value outside our control
+		p.cachedir, p.cacheval = direction, ""
+	}
+	return nil
 }
 
 func (p *gport) readDirection() (string, error) {
-	return readFile(p.direction)
+	if p.trusted && p.cachedir != "" {
+		return p.cachedir, nil
+	}
+	direction, err := readFile(p.direction)
+	p.metrics.read(err)
+	return direction, err
 }
 
 func (p *gport) writeValue(value string) error {
-	return writeFile(p.value, value)
+	err := p.writeAttr(p.value, value)
+	p.metrics.write(err)
+	if err != nil {
+		p.cacheval = ""
+		return err
+	}
+	p.cacheval = value
+	return nil
 }
 
 func (p *gport) readValue() (string, error) {
-	return readFile(p.value)
+	if p.trusted && p.cacheval != "" {
+		return p.cacheval, nil
+	}
+	value, err := p.readValueFile()
+	p.metrics.read(err)
+	return value, err
+}
+
+// readValueFile reads the value file through a file kept open for the purpose, which saves opening and closing it
+// for each read (as the monitor does). An alternative FileSystem is read as usual.
+func (p *gport) readValueFile() (string, error) {
+	if !isOSFileSystem() {
+		return readFile(p.value)
+	}
+	value, err := p.readOpenValue()
+	if err != nil && p.valuef != nil {
+		// the port may have been exported again since the file was opened
+		p.closeValue()
+		value, err = p.readOpenValue()
+	}
+	return value, err
+}
+
+// readOpenValue reads the value from the start of the open value file, opening it first if it is not open
+func (p *gport) readOpenValue() (string, error) {
+	if p.valuef == nil {
+		valf, err := os.Open(p.value)
+		if err != nil {
+			trace("read", p.value, nil, err)
+			return "", err
+		}
+		p.valuef = valf
+	}
+	// reset it for read
+	if _, err := p.valuef.Seek(0, 0); err != nil {
+		trace("read", p.value, nil, err)
+		return "", err
+	}
+	buff := make([]byte, 16)
+	n, err := p.valuef.Read(buff)
+	if err != nil {
+		trace("read", p.value, nil, err)
+		return "", err
+	}
+	trace("read", p.value, buff[:n], nil)
+	return strings.TrimSpace(string(buff[:n])), nil
+}
+
+// closeValue closes the open value file, if there is one
+func (p *gport) closeValue() {
+	if p.valuef != nil {
+		p.valuef.Close()
+		p.valuef = nil
+	}
+}
+
+// invalidate discards the cached direction and value
+func (p *gport) invalidate() {
+	p.cachedir = ""
+	p.cacheval = ""
+}
+
+// parseDirection converts the contents of a direction file to the mode
+func parseDirection(direction string) (GPIOMode, error) {
+	switch direction {
+	case direction_in:
+		return GPIOInput, nil
+	case direction_out:
+		return GPIOOutput, nil
+	}
+	return GPIOInput, fmt.Errorf("GPIO direction %v is not recognized", direction)
+}
+
+// parseEdge converts the contents of an edge file to the edge
+func parseEdge(edge string) (GPIOEdge, error) {
+	switch edge {
+	case edge_none:
+		return GPIOEdgeNone, nil
+	case edge_rising:
+		return GPIOEdgeRising, nil
+	case edge_falling:
+		return GPIOEdgeFalling, nil
+	case edge_both:
+		return GPIOEdgeBoth, nil
+	}
+	return GPIOEdgeNone, fmt.Errorf("GPIO edge %v is not recognized", edge)
+}
+
+// edgeMatches returns true if a change to the value is one of the edge's transitions
+func edgeMatches(edge GPIOEdge, value bool) bool {
+	switch edge {
+	case GPIOEdgeRising:
+		return value
+	case GPIOEdgeFalling:
+		return !value
+	}
+	return true
+}
+
+// SetKeepExported controls whether the port is left exported and configured when the library resets ports
+// automatically, for example in ResetAllOnSignal, so that another process can use it after this one exits.
+// An explicit Reset still unexports a kept port. Ports are not kept by default.
+func (p *gport) SetKeepExported(keep bool) {
+
+	defer p.unlock(p.lock())
+
+	p.kept = keep
+}
+
+// SetEventHistory makes the port retain the last size events that its monitors report, for replay to watches that
+// start later with WatchConfig.Replay, for example a debugging panel that connects on demand. The events are only
+// recorded while the port is watched, and with more than one watch at a time, each records the events it reports.
+// The history is cleared when the port is reset, and a size of 0 (the default) retains nothing.
+func (p *gport) SetEventHistory(size int) error {
+
+	defer p.unlock(p.lock())
+
+	if size < 0 {
+		return fmt.Errorf("GPIO %v event history size %v can not be negative", p.port, size)
+	}
+	p.history = nil
+	if size > 0 {
+		p.history = newEventHistory(size)
+	}
+	return nil
+}
+
+// isKept returns true if the port should not be reset automatically
+func (p *gport) isKept() bool {
+
+	defer p.unlock(p.lock())
+
+	return p.kept
+}
+
+// release stops the port's monitors and SetValues, as Reset does, but leaves the port exported
+func (p *gport) release() {
+
+	defer p.unlock(p.lock())
+
+	p.runResetters()
+	p.closeValue()
+}
+
+// SetPermissionRetry makes writes to the port's control files (by SetMode, SetValue, etc.) that are denied access
+// retry, every 20ms for up to the timeout, before failing. That covers the time after a port is exported until a udev
+// rule grants access to it, which otherwise fails writes made soon after boot. Other errors, including the "operation
+// not permitted" of writing the value of an input, fail without a retry. A timeout of 0 (the default) never retries.
+func (p *gport) SetPermissionRetry(timeout time.Duration) {
+
+	defer p.unlock(p.lock())
+
+	p.permretry = timeout
+}
+
+// SetSafeState makes Reset (and ResetAllOnSignal) drive the port as an output at the level before it is unexported,
+// even if it was an input, so actuators like relays and motor drivers are left off rather than floating or at their
+// last value. The level is a value, like in SetValue, so it is inverted on an active low port. The pin keeps driving
+// the level after it is unexported. If the level can not be driven, the port is not unexported, and Reset returns
+// the error. Kept ports (see SetKeepExported) are not reset by ResetAllOnSignal.
+func (p *gport) SetSafeState(level bool) {
+
+	defer p.unlock(p.lock())
+
+	p.hassafe = true
+	p.safestate = level
+}
+
+// ClearSafeState makes Reset unexport the port without driving it first, as it does without SetSafeState
+func (p *gport) ClearSafeState() {
+
+	defer p.unlock(p.lock())
+
+	p.hassafe = false
+}
+
+// driveSafeState makes the port an output at the safe level, and needs to be called with the port locked
+func (p *gport) driveSafeState() error {
+	// the direction's "high" and "low" are the raw level, which active_low does not invert
+	activelow, err := readFile(p.activelow)
+	if err != nil {
+		return err
+	}
+	direction := direction_outlow
+	if p.safestate != (activelow == high) {
+		direction = direction_outhi
+	}
+	return p.writeDirection(direction)
+}
+
+// SetTrusted controls whether the port returns the direction and output value it last wrote, instead of reading sysfs
+// each time. Only trust a port that this process owns exclusively, as changes made elsewhere are not seen until Refresh.
+// Input values are never cached. Ports are not trusted by default.
+func (p *gport) SetTrusted(trusted bool) {
+
+	defer p.unlock(p.lock())
+
+	// anything cached while untrusted may be stale
+	p.invalidate()
+	p.trusted = trusted
+}
+
+// Refresh discards the cached state of a trusted port, and re-reads it from sysfs
+func (p *gport) Refresh() error {
+
+	defer p.unlock(p.lock())
+
+	p.invalidate()
+
+	err := p.checkEnabled()
+	if err != nil {
+		return err
+	}
+
+	dir, err := p.readDirection()
+	if err != nil {
+		return err
+	}
+	if dir != direction_out {
+		p.cachedir = dir
+		return nil
+	}
+	val, err := p.readValue()
+	if err != nil {
+		return err
+	}
+	p.cachedir, p.cacheval = dir, val
+	return nil
+}
+
+// isBusy returns true if the error is the one sysfs gives when exporting a port that is already exported
+func isBusy(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.EBUSY
+}
+
+// isDenied returns true if the error is the one sysfs gives when the process has no access to a file (yet)
+func isDenied(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.EACCES
 }
 
 func (p *gport) checkEnabled() error {
@@ -8,52 +8,146 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func monitorData(valf *os.File, data chan<- Event, killer <-chan bool) {
+// monitorData reports the value of the port on the data channel, waiting for edges if the port can interrupt, and
+// otherwise polling the value for changes that match the edge. valf is nil when an alternative FileSystem is in use,
+// and the value is then read by name from fs, which can only be polled. It returns the error that terminated it, or nil
+// if it was killed.
+func monitorData(name string, valf *os.File, fs FileSystem, data chan<- Event, killer <-chan bool, cfg WatchConfig, interrupts bool, history *eventHistory, metrics *portCounters) (failure error) {
 
 	// This is run inside a goroutine
 
 	defer func() {
-		info("GPIO Monitor %v killing\n", valf.Name())
-		close(data)
-		valf.Close()
+		debug("GPIO Monitor %v killing\n", name)
+		if valf != nil {
+			valf.Close()
+		}
 	}()
 
 	// create a buffer to read the values in to.
 	buff := make([]byte, 10)
 
-	timeout := 500
+	timeout := cfg.PollTimeout
 	pollflag := int16(unix.POLLPRI | unix.POLLERR)
-	fd := int32(valf.Fd())
+
+	// read gets the current value, or nil if the monitor should terminate, with the failure set
+	read := func() *Event {
+		stamp := time.Now()
+
+		if valf == nil {
+			got, err := fs.ReadFile(name)
+			trace("read", name, got, err)
+			if err != nil {
+				errorf("GPIO Monitor %v terminating: %v\n", name, err)
+				failure = err
+				return nil
+			}
+			val := strings.TrimSpace(string(got)) == "1"
+			return &Event{Value: val, Timestamp: stamp, Previous: val}
+		}
+
+		// reset it for read
+		if _, err := valf.Seek(0, 0); err != nil {
+			errorf("GPIO Monitor %v terminating: %v\n", name, err)
+			failure = err
+			return nil
+		}
+
+		n, err := valf.Read(buff)
+		if err != nil {
+			errorf("GPIO Monitor %v terminating: %v\n", name, err)
+			failure = err
+			return nil
+		}
+		got := strings.TrimSpace(string(buff[:n]))
+		val := got == "1"
+		return &Event{Value: val, Timestamp: stamp, Previous: val}
+	}
+
+	// debounce state: the last event sent, the end of the quiet window after it,
+	// and whether edges were suppressed in that window.
+	var last *Event
+	var settle time.Time
+	suppressed := false
+
+	// send delivers the event, or drops it if the consumer is too slow, and returns false if the monitor should terminate
+	send := func(event *Event) bool {
+		if last != nil {
+			event.Previous = last.Value
+			event.Dwell = event.Timestamp.Sub(last.Timestamp)
+		}
+		history.add(*event)
+		metrics.event()
+		select {
+		case data <- *event:
+			last = event
+			settle = event.Timestamp.Add(cfg.Debounce)
+			return true
+		case <-killer:
+			// normal shut down
+			return false
+		default:
+		}
+
+		if cfg.SendTimeout > 0 {
+			tout := time.NewTimer(cfg.SendTimeout)
+			defer tout.Stop()
+			select {
+			case data <- *event:
+				last = event
+				settle = event.Timestamp.Add(cfg.Debounce)
+				return true
+			case <-killer:
+				return false
+			case <-tout.C:
+			}
+		}
+		warn("GPIO Monitor %v dropped event %v: receive channel overflow\n", name, event)
+		return true
+	}
 
 	ready := true
+	// a polled event is read already, and polled is the value it last read
+	var polledEvent *Event
+	polled := false
 
 	for {
 
 		if ready {
-			stamp := time.Now()
 			ready = false
 
-			// reset it for read
-			if _, err := valf.Seek(0, 0); err != nil {
-				info("GPIO Monitor %v terminating: %v\n", valf.Name(), err)
+			event := polledEvent
+			polledEvent = nil
+			if event == nil {
+				if event = read(); event == nil {
+					return
+				}
+			}
+			polled = event.Value
+			if last == nil {
+				event.Baseline = true
+			}
+			if last == nil && cfg.SkipBaseline {
+				// not sent, but the reference for the first transition
+				last = event
+				settle = event.Timestamp.Add(cfg.Debounce)
+			} else if cfg.Debounce > 0 && last != nil && event.Timestamp.Before(settle) {
+				// bouncing, check the value again when it settles.
+				suppressed = true
+			} else if last != nil && !edgeMatches(cfg.Edge, event.Value) {
+				// the port signals both edges, this watch only reports its own
+			} else if !send(event) {
 				return
 			}
+		}
 
-			n, err := valf.Read(buff)
-			if err != nil {
-				info("GPIO Monitor %v terminating: %v\n", valf.Name(), err)
+		if suppressed && !time.Now().Before(settle) {
+			suppressed = false
+			event := read()
+			if event == nil {
 				return
 			}
-			got := strings.TrimSpace(string(buff[:n]))
-			val := got == "1"
-			event := Event{val, stamp}
-			select {
-			case data <- event:
-			case <-killer:
-				// normal shut down
-				return
-			default:
-				info("GPIO Monitor %v terminating: send receive channel overflow\n", valf.Name())
+			polled = event.Value
+			if event.Value != last.Value && edgeMatches(cfg.Edge, event.Value) && !send(event) {
 				return
 			}
 		}
@@ -66,12 +160,42 @@ func monitorData(valf *os.File, data chan<- Event, killer <-chan bool) {
 			// keep on moving ... nothing to do here.
 		}
 
-		// wait up to some period for data to be there....
-		pollspec := []unix.PollFd{{Fd: fd, Events: pollflag}}
-		state, err := unix.Poll(pollspec, timeout)
+		// wait up to some period for data to be there, but no longer than it takes to settle a bounce.
+		wait := timeout
+		if suppressed {
+			if remaining := time.Until(settle); remaining < wait {
+				wait = remaining
+			}
+		}
+		if !interrupts {
+			if wait > EdgelessPollInterval {
+				wait = EdgelessPollInterval
+			}
+			sleep := time.NewTimer(wait)
+			select {
+			case <-killer:
+				sleep.Stop()
+				return
+			case <-sleep.C:
+			}
+			event := read()
+			if event == nil {
+				return
+			}
+			if event.Value != polled {
+				polled = event.Value
+				if edgeMatches(cfg.Edge, event.Value) {
+					polledEvent, ready = event, true
+				}
+			}
+			continue
+		}
+
+		pollspec := []unix.PollFd{{Fd: int32(valf.Fd()), Events: pollflag}}
+		state, err := unix.Poll(pollspec, int((wait+time.Millisecond-1)/time.Millisecond))
 		if err != nil {
-			info("GPIO Monitor %v terminating: %v\n", valf.Name(), err)
-			return
+			errorf("GPIO Monitor %v terminating: %v\n", name, err)
+			return err
 		}
 
 		if state > 0 {
@@ -83,12 +207,22 @@ func monitorData(valf *os.File, data chan<- Event, killer <-chan bool) {
 
 }
 
-func buildMonitor(fname string, buffersize int) (<-chan Event, func(), error) {
+// buildMonitor starts a monitor of the value file, and returns its channel, the function that kills it, and a function
+// that returns the error that terminated it, which is only set once the channel is closed
+func buildMonitor(fname string, cfg WatchConfig, interrupts bool, history *eventHistory, metrics *portCounters) (<-chan Event, func(), func() error, error) {
 
-	// open the value file, we will need the file descriptor
-	valf, err := os.Open(fname)
-	if err != nil {
-		return nil, nil, err
+	// open the value file, we will need the file descriptor. An alternative FileSystem is polled by name instead,
+	// and kept for the monitor in case it is replaced before the monitor ends.
+	var valf *os.File
+	fs := filesystem
+	if isOSFileSystem() {
+		f, err := os.Open(fname)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		valf = f
+	} else if _, err := readFile(fname); err != nil {
+		return nil, nil, nil, err
 	}
 
 	killer := make(chan bool, 1)
@@ -99,10 +233,21 @@ func buildMonitor(fname string, buffersize int) (<-chan Event, func(), error) {
 		}
 	}
 
-	data := make(chan Event, buffersize)
+	data := make(chan Event, cfg.Buffer)
+	if cfg.Replay {
+		for _, event := range history.recent(cfg.Buffer - 1) {
+			data <- event
+		}
+	}
 
-	go monitorData(valf, data, killer)
+	var failure error
+	done := startBackground(killfn)
+	go func() {
+		defer done()
+		failure = monitorData(fname, valf, fs, data, killer, cfg, interrupts, history, metrics)
+		close(data)
+	}()
 
-	return data, killfn, nil
+	return data, killfn, func() error { return failure }, nil
 
 }
@@ -1,7 +1,17 @@
 package gopisysfs
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestResetNoop(t *testing.T) {
@@ -18,3 +28,1031 @@ func TestResetNoop(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// fakeExported creates the sysfs folder and control files of an exported port in the test tree.
+// Call the returned function to remove them again.
+func fakeExported(t testing.TB, port GPIOPort, direction, value string) func() {
+	folder := port.(*gport).folder
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"direction":  direction,
+		"value":      value,
+		"edge":       "none",
+		"active_low": "0",
+	} {
+		if err := writeFile(filepath.Join(folder, name), content+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		os.RemoveAll(folder)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := port.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Enabled {
+		t.Fatalf("Expected port %v to not be enabled", testoutport)
+	}
+
+	defer fakeExported(t, port, "out", "1")()
+	state, err = port.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := PortState{Enabled: true, Direction: GPIOOutput, Value: true, Edge: GPIOEdgeNone}
+	if state != expect {
+		t.Errorf("Expected state %+v but got %+v", expect, state)
+	}
+	t.Logf("Got state %v", port.State())
+}
+
+func TestResetContextCancelled(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fake an exported port that sysfs never removes
+	defer fakeExported(t, port, "in", "0")()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = port.ResetContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed >= timelimit {
+		t.Fatalf("Expected ResetContext to return on cancel, but it took %v", elapsed)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "0")()
+
+	values, err := port.Values(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := port.SetValues(make(chan bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after := runtime.NumGoroutine(); after <= before {
+		t.Fatalf("Expected background goroutines, but have %v before and %v after", before, after)
+	}
+
+	Shutdown()
+
+	for range values {
+		// drain the initial value, until closed
+	}
+	for range errs {
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("Expected no more than %v goroutines after Shutdown but have %v", before, after)
+	}
+}
+
+func TestWaitForValue(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+	if err := port.SetMode(GPIOOutputLow); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := port.WaitForValue(false, time.Millisecond); err != nil {
+		t.Errorf("Expected an immediate return at the current value, but got %v", err)
+	}
+	if err := port.WaitForValue(true, 50*time.Millisecond); err == nil {
+		t.Errorf("Expected a timeout waiting for a value that does not change")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		port.SetValue(true)
+	}()
+	if err := port.WaitForValue(true, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWaitForValueShared(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "0")()
+	defer Shutdown()
+	gp := port.(*gport)
+
+	values, err := port.Values(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-values
+	resetters := len(gp.resetters)
+
+	// the plain test files never interrupt, so the wait times out, but it must not change the shared edge
+	if err := port.WaitForValue(true, 20*time.Millisecond); err == nil {
+		t.Errorf("Expected a timeout waiting for a value that does not change")
+	}
+	if edge, err := readFile(gp.edge); err != nil || edge != edge_both {
+		t.Errorf("Expected the edge of the shared monitor to stay %v, but got %v (%v)", edge_both, edge, err)
+	}
+	if len(gp.resetters) != resetters {
+		t.Errorf("Expected the wait to not add resetters, but got %v instead of %v", len(gp.resetters), resetters)
+	}
+}
+
+func TestWaitForValueInterrupts(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "0")()
+	defer Shutdown()
+	gp := port.(*gport)
+
+	// the port can interrupt, so the wait starts a shared monitor, which signals both edges, and stops it again
+	if err := port.WaitForValue(true, 20*time.Millisecond); err == nil {
+		t.Errorf("Expected a timeout waiting for a value that does not change")
+	}
+	if edge, err := readFile(gp.edge); err != nil || edge != edge_both {
+		t.Errorf("Expected the wait to monitor edge %v, but got %v (%v)", edge_both, edge, err)
+	}
+	defer gp.unlock(gp.lock())
+	if gp.fanout != nil {
+		t.Errorf("Expected the wait to stop the shared monitor it started")
+	}
+	gp.resetmu.Lock()
+	defer gp.resetmu.Unlock()
+	if len(gp.resetters) != 0 {
+		t.Errorf("Expected the wait to leave no resetters, but got %v", len(gp.resetters))
+	}
+}
+
+func TestWaitForValueSubscriber(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "0")()
+	defer Shutdown()
+
+	// the value is polled without an edge file, so the plain test files can change it
+	gp := port.(*gport)
+	if err := os.Remove(gp.edge); err != nil {
+		t.Fatal(err)
+	}
+	values, err := port.Values(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-values
+
+	go func() {
+		time.Sleep(5 * EdgelessPollInterval)
+		writeFileSync(gp.value, "1")
+		time.Sleep(5 * EdgelessPollInterval)
+		writeFileSync(gp.value, "0")
+	}()
+	if err := port.WaitForValue(true, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := port.WaitForValue(false, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []bool{true, false} {
+		select {
+		case event := <-values:
+			if event.Value != expect {
+				t.Errorf("Expected the subscriber to get %v but got %+v", expect, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the subscriber to get the %v edge", expect)
+		}
+	}
+}
+
+func TestTrustedCache(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+	port.SetTrusted(true)
+	if err := port.SetMode(GPIOOutputHigh); err != nil {
+		t.Fatal(err)
+	}
+
+	// change the value behind the port's back, the trusted port keeps the value it wrote
+	fname := port.(*gport).value
+	if err := fs.WriteFile(fname, []byte(low)); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := port.Value(); err != nil || !val {
+		t.Errorf("Expected the cached value true but got %v (%v)", val, err)
+	}
+	if err := port.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := port.Value(); err != nil || val {
+		t.Errorf("Expected the refreshed value false but got %v (%v)", val, err)
+	}
+}
+
+func TestEnumText(t *testing.T) {
+	type config struct {
+		Mode GPIOMode
+		Edge GPIOEdge
+	}
+	data, err := json.Marshal(config{GPIOOutputHigh, GPIOEdgeRising})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"Mode":"high","Edge":"rising"}` {
+		t.Errorf("Unexpected JSON %s", data)
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mode != GPIOOutputHigh || cfg.Edge != GPIOEdgeRising {
+		t.Errorf("Expected a round trip but got %+v", cfg)
+	}
+
+	for _, bad := range []string{`{"Mode":"sideways"}`, `{"Edge":"up"}`} {
+		if err := json.Unmarshal([]byte(bad), &cfg); err == nil {
+			t.Errorf("Expected an error decoding %v", bad)
+		}
+	}
+	if _, err := json.Marshal(config{Mode: GPIOMode(9)}); err == nil {
+		t.Errorf("Expected an error encoding an unknown mode")
+	}
+}
+
+func TestMinSwitchInterval(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenOutput(testoutport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	interval := 50 * time.Millisecond
+	port.SetMinSwitchInterval(interval, false)
+	if err := port.SetValue(true); err != nil {
+		t.Fatal(err)
+	}
+	// not a switch
+	if err := port.SetValue(true); err != nil {
+		t.Fatal(err)
+	}
+	err = port.SetValue(false)
+	if tooSoon, ok := err.(*SwitchTooSoonError); !ok || tooSoon.Wait <= 0 || tooSoon.Wait > interval {
+		t.Errorf("Expected a SwitchTooSoonError but got %v", err)
+	}
+
+	port.SetMinSwitchInterval(interval, true)
+	start := time.Now()
+	if err := port.SetValue(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := port.SetValue(true); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < interval {
+		t.Errorf("Expected the second switch to wait for %v, but it took %v", interval, elapsed)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+
+	called := make(chan Event, 1)
+	stop, err := port.OnChange(func(e Event) {
+		called <- e
+		panic("callback failure")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-called:
+		if !e.Value {
+			t.Errorf("Expected the initial value to be true")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a callback with the initial value")
+	}
+	stop()
+	Shutdown()
+}
+
+func TestEventReplay(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+	defer Shutdown()
+
+	if err := port.SetEventHistory(4); err != nil {
+		t.Fatal(err)
+	}
+	first, stop, err := port.Watch(WatchConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := <-first
+	stop()
+
+	late, stop, err := port.Watch(WatchConfig{Replay: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	select {
+	case replayed := <-late:
+		if !replayed.Timestamp.Equal(initial.Timestamp) {
+			t.Errorf("Expected the replay of %v but got %v", initial, replayed)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a replayed event")
+	}
+	select {
+	case live := <-late:
+		if !live.Timestamp.After(initial.Timestamp) {
+			t.Errorf("Expected a live event after the replay but got %v", live)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a live event")
+	}
+}
+
+func TestSetValueIfChanged(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenOutput(testoutport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+	port.SetTrusted(true)
+	if err := port.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := port.Metrics()
+	for i, tc := range []struct {
+		value   bool
+		changed bool
+	}{{false, false}, {true, true}, {true, false}, {false, true}} {
+		changed, err := port.SetValueIfChanged(tc.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != tc.changed {
+			t.Errorf("Expected set %v to %v to change %v but got %v", i, tc.value, tc.changed, changed)
+		}
+	}
+	// the trusted port only writes the changes, and reads nothing
+	if after := port.Metrics(); after.Writes != before.Writes+2 || after.Reads != before.Reads {
+		t.Errorf("Expected 2 writes and no reads after %+v but got %+v", before, after)
+	}
+}
+
+func TestModeInitialLevel(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenOutput(testoutport, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	// the kernel normalizes the direction
+	if dir, err := readFile(port.(*gport).direction); err != nil || dir != direction_out {
+		t.Errorf("Expected the direction to read back as %q but got %q (%v)", direction_out, dir, err)
+	}
+	if mode, err := port.Mode(); err != nil || mode != GPIOOutputHigh {
+		t.Errorf("Expected mode %v but got %v (%v)", GPIOOutputHigh, mode, err)
+	}
+	if output, err := port.IsOutput(); err != nil || !output {
+		t.Errorf("Expected an output (%v)", err)
+	}
+	if err := port.SetMode(GPIOInput); err != nil {
+		t.Fatal(err)
+	}
+	if mode, err := port.Mode(); err != nil || mode != GPIOInput {
+		t.Errorf("Expected mode %v but got %v (%v)", GPIOInput, mode, err)
+	}
+}
+
+func TestEdgelessPolling(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+	defer Shutdown()
+
+	if ok, err := port.SupportsInterrupts(); err != nil || !ok {
+		t.Errorf("Expected a port with an edge file to support interrupts, but got %v: %v", ok, err)
+	}
+	gp := port.(*gport)
+	if err := os.Remove(gp.edge); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := port.SupportsInterrupts(); err != nil || ok {
+		t.Errorf("Expected a port without an edge file to not support interrupts, but got %v: %v", ok, err)
+	}
+
+	events, stop, err := port.Watch(WatchConfig{Edge: GPIOEdgeRising})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if initial := <-events; !initial.Value {
+		t.Errorf("Expected the initial value to be true")
+	}
+	// the falling edge is polled, but not reported
+	if err := writeFileSync(gp.value, "0"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * EdgelessPollInterval)
+	if err := writeFileSync(gp.value, "1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		if !event.Value {
+			t.Errorf("Expected a rising edge but got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the rising edge to be polled")
+	}
+}
+
+func TestWatchStopResetters(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+	defer Shutdown()
+	gp := port.(*gport)
+
+	for i := 0; i < 10; i++ {
+		events, stop, err := port.Watch(WatchConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		<-events
+		stop()
+		stop()
+	}
+	ch := make(chan bool)
+	if _, err := port.SetValues(ch); err != nil {
+		t.Fatal(err)
+	}
+	close(ch)
+	time.Sleep(10 * time.Millisecond)
+
+	gp.resetmu.Lock()
+	defer gp.resetmu.Unlock()
+	if len(gp.resetters) != 0 {
+		t.Errorf("Expected the stopped watches to remove their resetters, but %v remain", len(gp.resetters))
+	}
+}
+
+func TestWatchSharedEdge(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+	defer Shutdown()
+	gp := port.(*gport)
+
+	values, err := port.Values(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-values
+	for _, edge := range []GPIOEdge{GPIOEdgeRising, GPIOEdgeFalling} {
+		_, stop, err := port.Watch(WatchConfig{Edge: edge})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stop()
+		if got, err := readFile(gp.edge); err != nil || got != edge_both {
+			t.Errorf("Expected a %v watch to leave the port signalling %v, but got %v (%v)", edge, edge_both, got, err)
+		}
+	}
+}
+
+func TestWatchDebouncedEdge(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "0")()
+	defer Shutdown()
+
+	// the value is polled without an edge file, so the plain test files can change it
+	gp := port.(*gport)
+	if err := os.Remove(gp.edge); err != nil {
+		t.Fatal(err)
+	}
+	events, stop, err := port.Watch(WatchConfig{Edge: GPIOEdgeRising, Debounce: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	<-events
+	// edges are only reported once the baseline has settled
+	time.Sleep(300 * time.Millisecond)
+
+	// a rising edge, and a bounce that settles low
+	for _, value := range []string{"1", "0", "1", "0"} {
+		if err := writeFileSync(gp.value, value); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * EdgelessPollInterval)
+	}
+	select {
+	case event := <-events:
+		if !event.Value {
+			t.Errorf("Expected the rising edge but got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the rising edge to be reported")
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected the bounce to settle without a falling event, but got %+v", event)
+	case <-time.After(400 * time.Millisecond):
+	}
+}
+
+func TestWatchBaseline(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "0")()
+	defer Shutdown()
+
+	// the value is polled without an edge file, so the plain test files can change it
+	gp := port.(*gport)
+	if err := os.Remove(gp.edge); err != nil {
+		t.Fatal(err)
+	}
+
+	events, stop, err := port.Watch(WatchConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if initial := <-events; !initial.Baseline || initial.Value {
+		t.Errorf("Expected a false baseline but got %+v", initial)
+	}
+
+	edges, stopedges, err := port.Watch(WatchConfig{SkipBaseline: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopedges()
+	time.Sleep(5 * EdgelessPollInterval)
+	if err := writeFileSync(gp.value, "1"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-edges:
+		if event.Baseline || !event.Value || event.Previous || event.Dwell <= 0 {
+			t.Errorf("Expected a rising transition from the skipped baseline but got %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the rising edge to be polled")
+	}
+	if event := <-events; event.Baseline || !event.Value {
+		t.Errorf("Expected a rising transition but got %+v", event)
+	}
+}
+
+func TestWatchUntil(t *testing.T) {
+	SetLogFn(t.Logf)
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+	defer Shutdown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var handled []Event
+	err = port.WatchUntil(ctx, GPIOEdgeBoth, func(e Event) {
+		handled = append(handled, e)
+		cancel()
+	})
+	if err != context.Canceled {
+		t.Errorf("Expected the watch to end when the context was canceled, but got %v", err)
+	}
+	if len(handled) != 1 || !handled[0].Value {
+		t.Errorf("Expected the initial value to be handled but got %v", handled)
+	}
+
+	// the monitor is stopped while the port is watched
+	err = port.WatchUntil(context.Background(), GPIOEdgeBoth, func(Event) {
+		go port.(*gport).release()
+	})
+	if err == nil {
+		t.Errorf("Expected an error when the monitor stopped")
+	}
+}
+
+// failingFS fails the reads of the value files once it is told to
+type failingFS struct {
+	FileSystem
+	mu   sync.Mutex
+	fail bool
+}
+
+func (f *failingFS) ReadFile(name string) ([]byte, error) {
+	f.mu.Lock()
+	fail := f.fail
+	f.mu.Unlock()
+	if fail && filepath.Base(name) == "value" {
+		return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EIO}
+	}
+	return f.FileSystem.ReadFile(name)
+}
+
+func TestWatchUntilFailure(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	failing := &failingFS{FileSystem: fs}
+	SetFileSystem(failing)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenInput(testinport, GPIOEdgeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	err = port.WatchUntil(context.Background(), GPIOEdgeBoth, func(Event) {
+		failing.mu.Lock()
+		failing.fail = true
+		failing.mu.Unlock()
+	})
+	if err == nil || !strings.Contains(err.Error(), syscall.EIO.Error()) {
+		t.Errorf("Expected the monitor's read error but got %v", err)
+	}
+}
+
+// deniedFS denies the first writes to each file named in denials, as sysfs does before udev grants access
+type deniedFS struct {
+	FileSystem
+	denials map[string]int
+}
+
+func (d *deniedFS) WriteFile(name string, data []byte) error {
+	if d.denials[filepath.Base(name)] > 0 {
+		d.denials[filepath.Base(name)]--
+		return &os.PathError{Op: "open", Path: name, Err: syscall.EACCES}
+	}
+	return d.FileSystem.WriteFile(name, data)
+}
+
+func TestPermissionRetry(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	denied := &deniedFS{FileSystem: fs, denials: map[string]int{}}
+	SetFileSystem(denied)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	denied.denials["direction"] = 2
+	if err := port.SetMode(GPIOOutputLow); !os.IsPermission(err) {
+		t.Errorf("Expected a permission error without a retry, but got %v", err)
+	}
+
+	port.SetPermissionRetry(time.Second)
+	if err := port.SetMode(GPIOOutputLow); err != nil {
+		t.Errorf("Expected the write to be retried until it was allowed, but got %v", err)
+	}
+	// the value of an output can be written, but not of an input, which fails immediately
+	if err := port.SetMode(GPIOInput); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := port.SetValue(true); err == nil || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected writing an input to fail without a retry, but got %v after %v", err, time.Since(start))
+	}
+}
+
+func TestSafeState(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	log := &writeLog{FileSystem: fs}
+	SetFileSystem(log)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenInput(testoutport, GPIOEdgeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port.SetSafeState(false)
+	log.writes = nil
+	if err := port.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"direction=low", "unexport=" + fmt.Sprint(testoutport)}
+	if fmt.Sprint(log.writes) != fmt.Sprint(expect) {
+		t.Errorf("Expected the safe state to be driven before the port was unexported, but got %v", log.writes)
+	}
+
+	// the safe value of an active low port is the inverted level
+	port, err = pi.OpenInput(testoutport, GPIOEdgeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.(*gport).setActiveLow(true); err != nil {
+		t.Fatal(err)
+	}
+	port.SetSafeState(false)
+	log.writes = nil
+	if err := port.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"direction=high", "unexport=" + fmt.Sprint(testoutport)}
+	if fmt.Sprint(log.writes) != fmt.Sprint(expect) {
+		t.Errorf("Expected the active low safe state to drive the pin high, but got %v", log.writes)
+	}
+
+	// a cleared safe state is not driven
+	port, err = pi.OpenInput(testoutport, GPIOEdgeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port.SetSafeState(true)
+	port.ClearSafeState()
+	log.writes = nil
+	if err := port.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{"unexport=" + fmt.Sprint(testoutport)}
+	if fmt.Sprint(log.writes) != fmt.Sprint(expect) {
+		t.Errorf("Expected a cleared safe state to not be driven, but got %v", log.writes)
+	}
+}
+
+func TestEnableReset(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if !port.IsEnabled() {
+		t.Fatalf("Expected port %v to be enabled", testoutport)
+	}
+	if err := port.SetMode(GPIOOutputHigh); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := port.Value(); err != nil || !value {
+		t.Errorf("Expected the output to be high, but got %v: %v", value, err)
+	}
+	if err := port.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if port.IsEnabled() {
+		t.Errorf("Expected port %v to be reset", testoutport)
+	}
+	if checkFile(port.(*gport).folder) {
+		t.Errorf("Expected the folder of port %v to be removed by the unexport", testoutport)
+	}
+}
+
+func TestValueOpenFile(t *testing.T) {
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fakeExported(t, port, "in", "1")()
+	gp := port.(*gport)
+	defer gp.closeValue()
+
+	if value, err := port.Value(); err != nil || !value {
+		t.Fatalf("Expected the value to be true, but got %v: %v", value, err)
+	}
+	if gp.valuef == nil {
+		t.Fatalf("Expected the value file to be kept open")
+	}
+	// the open file reads each new value from the start
+	if err := writeFileSync(gp.value, "0"); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := port.Value(); err != nil || value {
+		t.Errorf("Expected the value to be false, but got %v: %v", value, err)
+	}
+}
+
+func benchmarkValue(b *testing.B, read func(*gport) (string, error)) {
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testinport)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fakeExported(b, port, "in", "1")()
+	gp := port.(*gport)
+	defer gp.closeValue()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := read(gp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkValueOpenFile reads the value through the file the port keeps open
+func BenchmarkValueOpenFile(b *testing.B) {
+	benchmarkValue(b, (*gport).readValueFile)
+}
+
+// BenchmarkValueReopen reads the value by opening the file for each read, as Value used to
+func BenchmarkValueReopen(b *testing.B) {
+	benchmarkValue(b, func(gp *gport) (string, error) {
+		return readFile(gp.value)
+	})
+}
+
+func TestSetModeOutputLevel(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	log := &writeLog{FileSystem: fs}
+	SetFileSystem(log)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenOutput(testoutport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	log.writes = nil
+	if err := port.SetMode(GPIOOutputHigh); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"value=1"}; fmt.Sprint(log.writes) != fmt.Sprint(expect) {
+		t.Errorf("Expected the level of an output to be set through the value, but got %v", log.writes)
+	}
+	if mode, err := port.Mode(); err != nil || mode != GPIOOutputHigh {
+		t.Errorf("Expected mode %v but got %v (%v)", GPIOOutputHigh, mode, err)
+	}
+
+	// the value of an active low port is inverted, but the direction's level is not
+	if err := port.(*gport).setActiveLow(true); err != nil {
+		t.Fatal(err)
+	}
+	log.writes = nil
+	if err := port.SetMode(GPIOOutputLow); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"value=1"}; fmt.Sprint(log.writes) != fmt.Sprint(expect) {
+		t.Errorf("Expected the raw low level to be the inverted value, but got %v", log.writes)
+	}
+
+	// the level in SetMode is not limited by the minimum switch interval, but SetValue is limited after it
+	port.SetMinSwitchInterval(time.Hour, false)
+	if err := port.SetMode(GPIOOutputHigh); err != nil {
+		t.Errorf("Expected SetMode to not be limited by the switch interval, but got %v", err)
+	}
+	if _, ok := port.SetValue(true).(*SwitchTooSoonError); !ok {
+		t.Errorf("Expected the SetMode level to count as a switch for SetValue")
+	}
+	port.SetMinSwitchInterval(0, false)
+
+	if err := port.SetMode(GPIOInput); err != nil {
+		t.Fatal(err)
+	}
+	log.writes = nil
+	if err := port.SetMode(GPIOOutputLow); err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"direction=low"}; fmt.Sprint(log.writes) != fmt.Sprint(expect) {
+		t.Errorf("Expected an input to change to an output through the direction, but got %v", log.writes)
+	}
+}
@@ -4,6 +4,6 @@ import (
 	"fmt"
 )
 
-func buildMonitor(fname string, buffersize int) (<-chan Event, func(), error) {
-	return nil, nil, fmt.Errorf("Do not support setupMonitor on windows")
+func buildMonitor(fname string, cfg WatchConfig, interrupts bool, history *eventHistory, metrics *portCounters) (<-chan Event, func(), func() error, error) {
+	return nil, nil, nil, fmt.Errorf("Do not support setupMonitor on windows")
 }
@@ -0,0 +1,286 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// from https://pinout.xyz/
+
+// signalNames maps the conventional names of the default (ALT0) functions on the header pins to BCM GPIO numbers.
+var signalNames = map[string]int{
+	"SDA0":      0,
+	"SCL0":      1,
+	"SDA1":      2,
+	"SCL1":      3,
+	"GPCLK0":    4,
+	"GPCLK1":    5,
+	"GPCLK2":    6,
+	"SPI0_CE1":  7,
+	"CE1":       7,
+	"SPI0_CE0":  8,
+	"CE0":       8,
+	"SPI0_MISO": 9,
+	"MISO":      9,
+	"SPI0_MOSI": 10,
+	"MOSI":      10,
+	"SPI0_SCLK": 11,
+	"SCLK":      11,
+	"PWM0":      12,
+	"PWM1":      13,
+	"TXD0":      14,
+	"TXD":       14,
+	"RXD0":      15,
+	"RXD":       15,
+	"PCM_CLK":   18,
+	"PCM_FS":    19,
+	"PCM_DIN":   20,
+	"PCM_DOUT":  21,
+	"ID_SD":     0,
+	"ID_SC":     1,
+}
+
+// gpioLabels gives the conventional label of each GPIO with a default (ALT0) function, the ones GPIOName uses
+var gpioLabels = map[int]string{
+	0: "SDA0", 1: "SCL0", 2: "SDA1", 3: "SCL1", 4: "GPCLK0", 5: "GPCLK1", 6: "GPCLK2",
+	7: "SPI0_CE1", 8: "SPI0_CE0", 9: "SPI0_MISO", 10: "SPI0_MOSI", 11: "SPI0_SCLK",
+	12: "PWM0", 13: "PWM1", 14: "TXD0", 15: "RXD0",
+	18: "PCM_CLK", 19: "PCM_FS", 20: "PCM_DIN", 21: "PCM_DOUT",
+}
+
+// wiringPiPins maps the WiringPi pin numbers to BCM GPIO numbers on revision 2 and later boards, and wiringPiRev1
+// has the pins that differ on the 26 pin revision 1 header
+var wiringPiPins = map[int]int{
+	0: 17, 1: 18, 2: 27, 3: 22, 4: 23, 5: 24, 6: 25, 7: 4, 8: 2, 9: 3, 10: 8, 11: 7, 12: 10, 13: 9, 14: 11, 15: 14,
+	16: 15, 21: 5, 22: 6, 23: 13, 24: 19, 25: 26, 26: 12, 27: 16, 28: 20, 29: 21, 30: 0, 31: 1,
+}
+
+var wiringPiRev1 = map[int]int{2: 21, 8: 0, 9: 1}
+
+// the names of the power and ground pins on the header
+const (
+	pin3V3 = "3V3"
+	pin5V  = "5V"
+	pinGND = "GND"
+)
+
+// headerLayouts gives the name of each physical pin on the P1 header, in pin order, for each header map (see setModelMaps)
+var headerLayouts = map[string][]string{
+	"26v10": {
+		pin3V3, pin5V, "GPIO0", pin5V, "GPIO1", pinGND, "GPIO4", "GPIO14", pinGND, "GPIO15",
+		"GPIO17", "GPIO18", "GPIO21", pinGND, "GPIO22", "GPIO23", pin3V3, "GPIO24", "GPIO10", pinGND,
+		"GPIO9", "GPIO25", "GPIO11", "GPIO8", pinGND, "GPIO7",
+	},
+	"26v20": {
+		pin3V3, pin5V, "GPIO2", pin5V, "GPIO3", pinGND, "GPIO4", "GPIO14", pinGND, "GPIO15",
+		"GPIO17", "GPIO18", "GPIO27", pinGND, "GPIO22", "GPIO23", pin3V3, "GPIO24", "GPIO10", pinGND,
+		"GPIO9", "GPIO25", "GPIO11", "GPIO8", pinGND, "GPIO7",
+	},
+	"40v10": {
+		pin3V3, pin5V, "GPIO2", pin5V, "GPIO3", pinGND, "GPIO4", "GPIO14", pinGND, "GPIO15",
+		"GPIO17", "GPIO18", "GPIO27", pinGND, "GPIO22", "GPIO23", pin3V3, "GPIO24", "GPIO10", pinGND,
+		"GPIO9", "GPIO25", "GPIO11", "GPIO8", pinGND, "GPIO7", "ID_SD", "ID_SC", "GPIO5", pinGND,
+		"GPIO6", "GPIO12", "GPIO13", pinGND, "GPIO19", "GPIO16", "GPIO26", "GPIO20", pinGND, "GPIO21",
+	},
+}
+
+// HeaderType identifies the layout of a P1 header
+type HeaderType string
+
+const (
+	// Header26V1 is the 26 pin header of the revision 1 boards
+	Header26V1 HeaderType = "26v10"
+	// Header26V2 is the 26 pin header of the revision 2 boards
+	Header26V2 HeaderType = "26v20"
+	// Header40V1 is the 40 pin header of the Model B+ and later boards
+	Header40V1 HeaderType = "40v10"
+)
+
+// Pins returns the name of each physical pin on the header, in pin order, like the PinStatus Name, for drawing
+// the pinout. It returns nil for an unknown header.
+func (h HeaderType) Pins() []string {
+	layout := headerLayouts[string(h)]
+	if layout == nil {
+		return nil
+	}
+	cp := make([]string, len(layout))
+	copy(cp, layout)
+	return cp
+}
+
+// GPIOPorts returns the GPIO ports on the header, in port order, as P1GPIOPorts does for a board with the header.
+// It returns nil for an unknown header.
+func (h HeaderType) GPIOPorts() []int {
+	var ports []int
+	switch h {
+	case Header26V1:
+		ports = GPIO26HeaderV1
+	case Header26V2:
+		ports = GPIO26HeaderV2
+	case Header40V1:
+		ports = GPIO40HeaderV1
+	default:
+		return nil
+	}
+	cp := make([]int, len(ports))
+	copy(cp, ports)
+	sort.Ints(cp)
+	return cp
+}
+
+// KnownRevisions returns each hardware revision that this package maps to a header explicitly, with that header.
+// Other revisions, including the new-style revision codes of later boards that are not listed, use Header40V1.
+func KnownRevisions() map[string]HeaderType {
+	known := make(map[string]HeaderType)
+	for header, revisions := range modelMaps {
+		for _, revision := range revisions {
+			known[revision] = HeaderType(header)
+		}
+	}
+	return known
+}
+
+// Header returns the type of the P1 header of this board
+func (p *pi) Header() HeaderType {
+	return HeaderType(p.header)
+}
+
+// PinStatus describes a physical pin on the P1 header
+type PinStatus struct {
+	// Physical is the pin number on the header, starting at 1
+	Physical int
+	// Name is the signal name of the pin, like GPIO23, or 3V3, 5V, and GND for power and ground pins
+	Name string
+	// BCM is the GPIO number of the pin, or -1 for power and ground pins
+	BCM int
+	// IsGPIO is true if the pin is one of the P1GPIOPorts
+	IsGPIO bool
+	// State is the configuration and value of a GPIO pin, with Enabled false if it is not exported
+	State PortState
+}
+
+// lookupSignal resolves a signal name like GPIO23, or SDA1, to the BCM GPIO number. Names are not case sensitive.
+func lookupSignal(name string) (int, error) {
+	uname := strings.ToUpper(strings.TrimSpace(name))
+	if port, ok := signalNames[uname]; ok {
+		return port, nil
+	}
+	if strings.HasPrefix(uname, "GPIO") {
+		if port, err := strconv.Atoi(uname[len("GPIO"):]); err == nil && port >= 0 {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("Signal name %v is not recognized", name)
+}
+
+// GetPortByName returns a control point in to a GPIO Port identified by its signal name, like GPIO23, SDA1, or TXD0.
+// The name has to resolve to a GPIO on the P1 header of this board.
+func (p *pi) GetPortByName(name string) (GPIOPort, error) {
+	port, err := lookupSignal(name)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsP1Port(port) {
+		return nil, fmt.Errorf("Signal %v (GPIO %v) is not on the P1 header of revision %v", name, port, p.revision)
+	}
+	return p.GetPort(port)
+}
+
+// GPIOName returns the conventional label of the GPIO on this board, for display, like SDA1 for 2, TXD0 for 14, or
+// GPCLK0 for 4. A pin the header labels specially, like ID_SD (GPIO0) on the 40 pin header, gets that label, and a
+// GPIO without a default function is labelled like GPIO17. GetPortByName accepts all of these labels.
+func (p *pi) GPIOName(port int) string {
+	for _, name := range headerLayouts[p.header] {
+		if strings.HasPrefix(name, "GPIO") {
+			continue
+		}
+		if bcm, err := lookupSignal(name); err == nil && bcm == port {
+			return name
+		}
+	}
+	if label, ok := gpioLabels[port]; ok {
+		return label
+	}
+	return fmt.Sprintf("GPIO%d", port)
+}
+
+// PhysicalToBCM returns the BCM GPIO number of the physical pin (1 to 26, or 40) on the P1 header of this board.
+// Like the other pin translations, it only depends on the board's header, so it works as well for a Pi from
+// GetDetailsFor, without being on one. Power and ground pins have no GPIO number, and are an error.
+func (p *pi) PhysicalToBCM(physical int) (int, error) {
+	layout := headerLayouts[p.header]
+	if physical < 1 || physical > len(layout) {
+		return 0, fmt.Errorf("Pin %v is not on the %v pin P1 header of revision %v", physical, len(layout), p.revision)
+	}
+	bcm, err := lookupSignal(layout[physical-1])
+	if err != nil {
+		return 0, fmt.Errorf("Pin %v is %v on the P1 header of revision %v, not a GPIO", physical, layout[physical-1], p.revision)
+	}
+	return bcm, nil
+}
+
+// BCMToPhysical returns the physical pin on the P1 header of this board that the BCM GPIO is broken out on
+func (p *pi) BCMToPhysical(bcm int) (int, error) {
+	for i, name := range headerLayouts[p.header] {
+		if port, err := lookupSignal(name); err == nil && port == bcm {
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("GPIO %v is not on the P1 header of revision %v", bcm, p.revision)
+}
+
+// WiringPiToBCM returns the BCM GPIO number of the WiringPi pin number on this board. Only the WiringPi pins that are
+// on the P1 header are translated, and the revision 1 boards number some of them differently.
+func (p *pi) WiringPiToBCM(wpi int) (int, error) {
+	bcm, ok := wiringPiPins[wpi]
+	if rev1, ok1 := wiringPiRev1[wpi]; ok1 && p.header == "26v10" {
+		bcm = rev1
+	}
+	// the pins after 16 are on the P5 header of 26 pin boards, or only on the 40 pin header
+	if wpi > 16 && len(headerLayouts[p.header]) < 40 {
+		ok = false
+	}
+	if ok {
+		if _, err := p.BCMToPhysical(bcm); err == nil {
+			return bcm, nil
+		}
+	}
+	return 0, fmt.Errorf("WiringPi pin %v is not on the P1 header of revision %v", wpi, p.revision)
+}
+
+// BCMToWiringPi returns the WiringPi pin number of the BCM GPIO on this board, see WiringPiToBCM
+func (p *pi) BCMToWiringPi(bcm int) (int, error) {
+	for wpi := 0; wpi <= 31; wpi++ {
+		if port, err := p.WiringPiToBCM(wpi); err == nil && port == bcm {
+			return wpi, nil
+		}
+	}
+	return 0, fmt.Errorf("GPIO %v has no WiringPi pin on the P1 header of revision %v", bcm, p.revision)
+}
+
+// HeaderSnapshot reads the status of every physical pin on the P1 header of this board, in pin order.
+// Power and ground pins are included, so the header can be drawn as it is.
+func (p *pi) HeaderSnapshot() ([]PinStatus, error) {
+	layout := headerLayouts[p.header]
+	pins := make([]PinStatus, 0, len(layout))
+	for i, name := range layout {
+		pin := PinStatus{Physical: i + 1, Name: name, BCM: -1}
+		if bcm, err := lookupSignal(name); err == nil {
+			pin.BCM = bcm
+			pin.IsGPIO = p.IsP1Port(bcm)
+		}
+		if pin.IsGPIO && availableGPIO[pin.BCM] {
+			port, err := p.GetPort(pin.BCM)
+			if err != nil {
+				return pins, err
+			}
+			if pin.State, err = port.Snapshot(); err != nil {
+				return pins, fmt.Errorf("Unable to read the state of pin %v (%v): %v", pin.Physical, name, err)
+			}
+		}
+		pins = append(pins, pin)
+	}
+	return pins, nil
+}
@@ -0,0 +1,193 @@
+package gopisysfs
+
+import (
+	"testing"
+)
+
+func TestGetPortByName(t *testing.T) {
+	pi40 := GetDetailsFor(testrevision, testmodel)
+	pi26 := GetDetailsFor("0002", "Model B Rev 1")
+	for _, tc := range []struct {
+		pi   Pi
+		name string
+		port int
+		ok   bool
+	}{
+		{pi40, "GPIO23", 23, true},
+		{pi40, "gpio27", 27, true},
+		{pi40, "SDA1", 2, true},
+		{pi40, "TXD0", 14, true},
+		{pi40, "SDA0", 0, false},
+		{pi40, "GPIO45", 0, false},
+		{pi40, "BOGUS", 0, false},
+		{pi26, "SDA0", 0, true},
+		{pi26, "SDA1", 0, false},
+		{pi26, "GPIO27", 0, false},
+	} {
+		port, err := tc.pi.GetPortByName(tc.name)
+		if !tc.ok {
+			if err == nil {
+				t.Errorf("Expected an error for signal %v but got port %v", tc.name, port)
+			} else {
+				t.Logf("Signal %v: %v", tc.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for signal %v: %v", tc.name, err)
+			continue
+		}
+		if port.(*gport).port != tc.port {
+			t.Errorf("Expected signal %v to be GPIO %v but got %v", tc.name, tc.port, port)
+		}
+	}
+}
+
+func TestGPIOName(t *testing.T) {
+	for _, tc := range []struct {
+		revision string
+		port     int
+		name     string
+	}{
+		{testrevision, 2, "SDA1"},
+		{testrevision, 4, "GPCLK0"},
+		{testrevision, 14, "TXD0"},
+		{testrevision, 0, "ID_SD"},
+		{testrevision, 17, "GPIO17"},
+		{"0002", 0, "SDA0"},
+	} {
+		board := GetDetailsFor(tc.revision, testmodel)
+		name := board.GPIOName(tc.port)
+		if name != tc.name {
+			t.Errorf("Expected GPIO %v of revision %v to be %v but got %v", tc.port, tc.revision, tc.name, name)
+		}
+		if port, err := lookupSignal(name); err != nil || port != tc.port {
+			t.Errorf("Expected the name %v to resolve to %v but got %v (%v)", name, tc.port, port, err)
+		}
+	}
+}
+
+func TestHeaderSnapshot(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	out, err := pi.OpenOutput(testoutport, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Reset()
+
+	pins, err := pi.HeaderSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 40 {
+		t.Fatalf("Expected 40 pins but got %v", len(pins))
+	}
+	gpios := 0
+	for i, pin := range pins {
+		if pin.Physical != i+1 {
+			t.Errorf("Expected pin %v to have physical number %v", pin, i+1)
+		}
+		if pin.IsGPIO {
+			gpios++
+		}
+	}
+	if gpios != len(pi.P1GPIOPorts()) {
+		t.Errorf("Expected %v GPIO pins but got %v", len(pi.P1GPIOPorts()), gpios)
+	}
+	if pin := pins[5]; pin.Name != "GND" || pin.BCM != -1 || pin.IsGPIO {
+		t.Errorf("Expected pin 6 to be ground but got %+v", pin)
+	}
+	if pin := pins[27]; pin.Name != "ID_SC" || pin.BCM != 1 || pin.IsGPIO {
+		t.Errorf("Expected pin 28 to be the reserved ID_SC but got %+v", pin)
+	}
+	// physical pin 16 is GPIO 23
+	expect := PinStatus{Physical: 16, Name: "GPIO23", BCM: testoutport, IsGPIO: true,
+		State: PortState{Enabled: true, Direction: GPIOOutput, Value: true, Edge: GPIOEdgeNone}}
+	if pins[15] != expect {
+		t.Errorf("Expected pin 16 to be %+v but got %+v", expect, pins[15])
+	}
+
+	if pins, err := GetDetailsFor("0002", "Model B Rev 1").HeaderSnapshot(); err != nil || len(pins) != 26 || pins[2].BCM != 0 {
+		t.Errorf("Expected a 26 pin header with GPIO 0 on pin 3 but got %+v (%v)", pins, err)
+	}
+}
+
+func TestPinTranslation(t *testing.T) {
+	for _, tc := range []struct {
+		revision string
+		physical int
+		bcm      int
+		wpi      int
+	}{
+		{"0002", 3, 0, 8},
+		{"0002", 13, 21, 2},
+		{"0002", 11, 17, 0},
+		{"000e", 3, 2, 8},
+		{"000e", 13, 27, 2},
+		{"000e", 26, 7, 11},
+		{testrevision, 3, 2, 8},
+		{testrevision, 12, 18, 1},
+		{testrevision, 27, 0, 30},
+		{testrevision, 40, 21, 29},
+	} {
+		board := GetDetailsFor(tc.revision, testmodel)
+		if bcm, err := board.PhysicalToBCM(tc.physical); err != nil || bcm != tc.bcm {
+			t.Errorf("Expected pin %v of revision %v to be GPIO %v but got %v (%v)", tc.physical, tc.revision, tc.bcm, bcm, err)
+		}
+		if physical, err := board.BCMToPhysical(tc.bcm); err != nil || physical != tc.physical {
+			t.Errorf("Expected GPIO %v of revision %v to be pin %v but got %v (%v)", tc.bcm, tc.revision, tc.physical, physical, err)
+		}
+		if bcm, err := board.WiringPiToBCM(tc.wpi); err != nil || bcm != tc.bcm {
+			t.Errorf("Expected WiringPi %v of revision %v to be GPIO %v but got %v (%v)", tc.wpi, tc.revision, tc.bcm, bcm, err)
+		}
+		if wpi, err := board.BCMToWiringPi(tc.bcm); err != nil || wpi != tc.wpi {
+			t.Errorf("Expected GPIO %v of revision %v to be WiringPi %v but got %v (%v)", tc.bcm, tc.revision, tc.wpi, wpi, err)
+		}
+	}
+
+	board := GetDetailsFor("000e", testmodel)
+	if _, err := board.PhysicalToBCM(6); err == nil {
+		t.Errorf("Expected an error translating a ground pin")
+	}
+	if _, err := board.PhysicalToBCM(40); err == nil {
+		t.Errorf("Expected an error translating pin 40 of a 26 pin header")
+	}
+	if _, err := board.WiringPiToBCM(21); err == nil {
+		t.Errorf("Expected an error translating a WiringPi pin that is only on the 40 pin header")
+	}
+	if _, err := GetDetailsFor("0002", testmodel).WiringPiToBCM(29); err == nil {
+		t.Errorf("Expected an error translating a WiringPi pin of GPIO 21 that is only on the 40 pin header")
+	}
+	if _, err := board.BCMToPhysical(5); err == nil {
+		t.Errorf("Expected an error translating a GPIO that is not on the 26 pin header")
+	}
+}
+
+func TestKnownRevisions(t *testing.T) {
+	known := KnownRevisions()
+	if known["0002"] != Header26V1 || known["000e"] != Header26V2 || known["0010"] != Header40V1 {
+		t.Errorf("Expected the revisions to map to their headers, but got %v", known)
+	}
+	known["0002"] = Header40V1
+	if KnownRevisions()["0002"] != Header26V1 {
+		t.Errorf("Expected KnownRevisions to return a copy")
+	}
+	if pins := Header40V1.Pins(); len(pins) != 40 || pins[0] != pin3V3 {
+		t.Errorf("Expected 40 pins starting with %v, but got %v", pin3V3, pins)
+	}
+	if ports := Header26V2.GPIOPorts(); len(ports) != len(GPIO26HeaderV2) {
+		t.Errorf("Expected %v ports, but got %v", GPIO26HeaderV2, ports)
+	}
+	if HeaderType("bogus").Pins() != nil || HeaderType("bogus").GPIOPorts() != nil {
+		t.Errorf("Expected no pins for an unknown header")
+	}
+	if pi := GetDetailsFor(testrevision, testmodel); pi.Header() != Header40V1 {
+		t.Errorf("Expected revision %v to have header %v, but got %v", testrevision, Header40V1, pi.Header())
+	}
+}
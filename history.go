@@ -0,0 +1,65 @@
+package gopisysfs
+
+import (
+	"sync"
+)
+
+// eventHistory retains the most recent events reported by a port's monitors in a ring buffer,
+// so they can be replayed to a watch that starts later, see SetEventHistory
+type eventHistory struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	count  int
+}
+
+func newEventHistory(size int) *eventHistory {
+	return &eventHistory{events: make([]Event, size)}
+}
+
+// add retains the event, replacing the oldest one if the history is full. A nil history retains nothing.
+func (h *eventHistory) add(event Event) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.events[h.next] = event
+	h.next = (h.next + 1) % len(h.events)
+	if h.count < len(h.events) {
+		h.count++
+	}
+}
+
+// recent returns up to limit of the most recent events, oldest first
+func (h *eventHistory) recent(limit int) []Event {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.count
+	if limit < n {
+		n = limit
+	}
+	ret := make([]Event, n)
+	start := h.next - n + len(h.events)
+	for i := range ret {
+		ret[i] = h.events[(start+i)%len(h.events)]
+	}
+	return ret
+}
+
+// clear discards the retained events
+func (h *eventHistory) clear() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.next = 0
+	h.count = 0
+}
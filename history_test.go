@@ -0,0 +1,37 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventHistory(t *testing.T) {
+	var none *eventHistory
+	none.add(Event{})
+	if got := none.recent(10); len(got) != 0 {
+		t.Errorf("Expected no events from a nil history but got %v", got)
+	}
+
+	h := newEventHistory(3)
+	base := time.Now()
+	for i := 0; i < 5; i++ {
+		h.add(Event{Value: i%2 == 0, Timestamp: base.Add(time.Duration(i) * time.Second)})
+	}
+	got := h.recent(10)
+	if len(got) != 3 {
+		t.Fatalf("Expected 3 retained events but got %v", len(got))
+	}
+	for i, event := range got {
+		if expect := base.Add(time.Duration(i+2) * time.Second); !event.Timestamp.Equal(expect) {
+			t.Errorf("Expected event %v at %v but got %v", i, expect, event.Timestamp)
+		}
+	}
+	if got := h.recent(1); len(got) != 1 || !got[0].Timestamp.Equal(base.Add(4*time.Second)) {
+		t.Errorf("Expected only the most recent event but got %v", got)
+	}
+
+	h.clear()
+	if got := h.recent(10); len(got) != 0 {
+		t.Errorf("Expected no events after clear but got %v", got)
+	}
+}
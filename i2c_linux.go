@@ -1,34 +1,176 @@
 package gopisysfs
 
 import (
-	"io/ioutil"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
+	"unsafe"
 )
 
 const (
 	sys_i2c   = "sys/class/i2c-dev"
+	dev_root  = "dev"
 	i2c_SLAVE = 0x703
+	i2c_FUNCS = 0x705
+
+	// DefaultI2CReadTimeout is how long a poller's read waits for a device to return all the bytes of a sample,
+	// when I2CPollNonBlocking does not specify it
+	DefaultI2CReadTimeout = 100 * time.Millisecond
+)
+
+// I2CFuncs is the functionality bitmask reported by an I2C adapter, indicating which transactions it supports.
+// See https://www.kernel.org/doc/Documentation/i2c/functionality
+type I2CFuncs uint64
+
+const (
+	I2CFuncI2C                 I2CFuncs = 0x00000001
+	I2CFunc10BitAddr           I2CFuncs = 0x00000002
+	I2CFuncProtocolMangling    I2CFuncs = 0x00000004
+	I2CFuncSMBusPEC            I2CFuncs = 0x00000008
+	I2CFuncNoStart             I2CFuncs = 0x00000010
+	I2CFuncSMBusQuick          I2CFuncs = 0x00010000
+	I2CFuncSMBusReadByte       I2CFuncs = 0x00020000
+	I2CFuncSMBusWriteByte      I2CFuncs = 0x00040000
+	I2CFuncSMBusReadByteData   I2CFuncs = 0x00080000
+	I2CFuncSMBusWriteByteData  I2CFuncs = 0x00100000
+	I2CFuncSMBusReadWordData   I2CFuncs = 0x00200000
+	I2CFuncSMBusWriteWordData  I2CFuncs = 0x00400000
+	I2CFuncSMBusProcCall       I2CFuncs = 0x00800000
+	I2CFuncSMBusReadBlockData  I2CFuncs = 0x01000000
+	I2CFuncSMBusWriteBlockData I2CFuncs = 0x02000000
+	I2CFuncSMBusReadI2CBlock   I2CFuncs = 0x04000000
+	I2CFuncSMBusWriteI2CBlock  I2CFuncs = 0x08000000
 )
 
-func I2CListDevices() ([]string, error) {
+// I2CFunctions queries the adapter behind the specified device (e.g. /dev/i2c-1) for the transactions it supports.
+func I2CFunctions(dev string) (I2CFuncs, error) {
+	ctrl, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer ctrl.Close()
+
+	return i2cFunctions(ctrl)
+}
+
+// i2cFunctions queries the functionality of an already open bus device
+func i2cFunctions(ctrl *os.File) (I2CFuncs, error) {
+	// the kernel writes an unsigned long, which is the size of a uintptr
+	var funcs uintptr
+	if err := i2cIoctl(ctrl, i2c_FUNCS, uintptr(unsafe.Pointer(&funcs))); err != nil {
+		return 0, err
+	}
+	return I2CFuncs(funcs), nil
+}
+
+// Has returns true if all the functionality in the mask is supported
+func (f I2CFuncs) Has(mask I2CFuncs) bool {
+	return f&mask == mask
+}
+
+// SupportsI2C returns true if the adapter supports plain I2C transfers, and not just SMBus commands
+func (f I2CFuncs) SupportsI2C() bool {
+	return f.Has(I2CFuncI2C)
+}
+
+// Supports10Bit returns true if the adapter supports 10-bit slave addresses
+func (f I2CFuncs) Supports10Bit() bool {
+	return f.Has(I2CFunc10BitAddr)
+}
+
+// SupportsSMBusByte returns true if the adapter supports SMBus receive/send byte commands
+func (f I2CFuncs) SupportsSMBusByte() bool {
+	return f.Has(I2CFuncSMBusReadByte | I2CFuncSMBusWriteByte)
+}
+
+// SupportsSMBusByteData returns true if the adapter supports SMBus read/write byte data (register) commands
+func (f I2CFuncs) SupportsSMBusByteData() bool {
+	return f.Has(I2CFuncSMBusReadByteData | I2CFuncSMBusWriteByteData)
+}
+
+// SupportsSMBusWordData returns true if the adapter supports SMBus read/write word data commands
+func (f I2CFuncs) SupportsSMBusWordData() bool {
+	return f.Has(I2CFuncSMBusReadWordData | I2CFuncSMBusWriteWordData)
+}
+
+// SupportsSMBusBlock returns true if the adapter supports SMBus read/write block data commands
+func (f I2CFuncs) SupportsSMBusBlock() bool {
+	return f.Has(I2CFuncSMBusReadBlockData | I2CFuncSMBusWriteBlockData)
+}
+
+// SupportsI2CBlock returns true if the adapter supports the I2C block read/write commands (SMBus style, without a count byte)
+func (f I2CFuncs) SupportsI2CBlock() bool {
+	return f.Has(I2CFuncSMBusReadI2CBlock | I2CFuncSMBusWriteI2CBlock)
+}
+
+// I2CListOption configures an I2CListDevices
+type I2CListOption func(*i2cListConfig)
+
+type i2cListConfig struct {
+	wait time.Duration
+}
+
+// I2CListWait makes I2CListDevices wait up to the timeout for the device nodes of the buses that sysfs lists, but
+// udev has not created yet, like when a service starts early in the boot. Without this option the device nodes
+// are checked once, and buses without one are left out immediately.
+func I2CListWait(timeout time.Duration) I2CListOption {
+	return func(cfg *i2cListConfig) {
+		cfg.wait = timeout
+	}
+}
+
+// I2CListDevices lists the device nodes of the I2C buses, like /dev/i2c-1. Both the sysfs class and the /dev
+// folder are relative to the configured root, so test fixtures can provide fake buses and device nodes.
+// Buses without a device node are left out, options like I2CListWait(...) can wait for them to appear.
+func I2CListDevices(opts ...I2CListOption) ([]string, error) {
+	cfg := &i2cListConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	devdir := file(sys_i2c)
-	files, err := ioutil.ReadDir(devdir)
+	files, err := filesystem.ReadDir(devdir)
 	if err != nil {
 		return nil, err
 	}
 
-	names := []string{}
+	// the polls for the missing device nodes all run at once, so the wait is the timeout, not the sum of them
+	polls := make(map[string]<-chan error)
+	devs := []string{}
 	for _, f := range files {
 		if f.IsDir() {
 			continue
 		}
 		name := f.Name()
-		dev := filepath.Join("/dev", name)
-		info("I2C Checking %v\n", dev)
-		if _, err := os.Stat(dev); err != nil {
+		dev := file(dev_root, name)
+		debug("I2C Checking %v\n", dev)
+		devs = append(devs, dev)
+		if _, err := filesystem.Stat(dev); err == nil || cfg.wait <= 0 {
+			continue
+		}
+		if ch, err := awaitFileCreate(dev, cfg.wait); err == nil {
+			polls[dev] = ch
+		}
+	}
+
+	names := []string{}
+	for _, dev := range devs {
+		if ch, ok := polls[dev]; ok {
+			if err := <-ch; err != nil {
+				debug("I2C Device %v did not appear: %v\n", dev, err)
+				continue
+			}
+		} else if _, err := filesystem.Stat(dev); err != nil {
 			continue
 		}
 		names = append(names, dev)
@@ -36,11 +178,243 @@ func I2CListDevices() ([]string, error) {
 	return names, nil
 }
 
+// I2CAdapter describes an I2C bus, and the adapter that drives it
+type I2CAdapter struct {
+	Bus int
+	// DevPath is the device node of the bus, like /dev/i2c-1
+	DevPath string
+	// Name is the adapter's name, like "bcm2835 (i2c@7e804000)", which tells hardware, bit-banged, and mux buses apart
+	Name string
+}
+
+// I2CListAdapters lists the I2C buses that have a device node, in bus order, with the names of their adapters.
+func I2CListAdapters() ([]I2CAdapter, error) {
+	devdir := file(sys_i2c)
+	files, err := filesystem.ReadDir(devdir)
+	if err != nil {
+		return nil, err
+	}
+
+	adapters := []I2CAdapter{}
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasPrefix(name, "i2c-") {
+			continue
+		}
+		bus, err := strconv.Atoi(strings.TrimPrefix(name, "i2c-"))
+		if err != nil {
+			continue
+		}
+		dev := file(dev_root, name)
+		if _, err := filesystem.Stat(dev); err != nil {
+			continue
+		}
+		// the name is informative, and not essential
+		adapter, _ := readFile(filepath.Join(devdir, name, "name"))
+		adapters = append(adapters, I2CAdapter{Bus: bus, DevPath: dev, Name: adapter})
+	}
+	sort.Slice(adapters, func(i, j int) bool { return adapters[i].Bus < adapters[j].Bus })
+	return adapters, nil
+}
+
+// ErrNoI2CBusSpeed is returned by I2CBusSpeed when the bus's adapter does not report its clock frequency, as is the
+// case for adapters that are not described by the device-tree, like those of USB bridges.
+var ErrNoI2CBusSpeed = errors.New("The I2C bus clock frequency is not reported by its adapter")
+
+// I2CBusSpeed returns the clock frequency, in Hz, that the bus device (e.g. /dev/i2c-1) is configured to run at, like
+// 100000 or 400000. It is the device-tree clock-frequency of the adapter, set by the overlay (dtparam=i2c_arm_baudrate),
+// and ErrNoI2CBusSpeed is returned if the adapter has none.
+func I2CBusSpeed(dev string) (int, error) {
+	name := file(sys_i2c, filepath.Base(dev), "device", "of_node", "clock-frequency")
+	data, err := readBytes(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, ErrNoI2CBusSpeed
+		}
+		return 0, err
+	}
+	// device-tree cells are big-endian 32 bit values
+	if len(data) != 4 {
+		return 0, fmt.Errorf("I2C bus %v clock-frequency of %v bytes is not a device-tree cell", dev, len(data))
+	}
+	return int(binary.BigEndian.Uint32(data)), nil
+}
+
 type I2CRecording struct {
 	Timestamp time.Time
 	Data      []byte
 }
 
+// I2CRawRecording is an I2CRecording that encodes in JSON with the standard base64 Data, for example
+// json.Marshal(I2CRawRecording(rec)), instead of hex.
+type I2CRawRecording I2CRecording
+
+// i2cRecordingJSON is the JSON form of an I2CRecording
+type i2cRecordingJSON struct {
+	Timestamp time.Time
+	Data      string
+	Value     *uint64 `json:",omitempty"`
+}
+
+// MarshalJSON encodes the recording with the Data as hex, to make it easy to compare with a data sheet.
+// Data of up to 8 bytes is also decoded as a big-endian unsigned Value.
+func (r I2CRecording) MarshalJSON() ([]byte, error) {
+	rec := i2cRecordingJSON{
+		Timestamp: r.Timestamp,
+		Data:      hex.EncodeToString(r.Data),
+	}
+	if len(r.Data) > 0 && len(r.Data) <= 8 {
+		value := uint64(0)
+		for _, b := range r.Data {
+			value = value<<8 | uint64(b)
+		}
+		rec.Value = &value
+	}
+	return json.Marshal(rec)
+}
+
+// UnmarshalJSON decodes a recording encoded by MarshalJSON. The Value is ignored.
+func (r *I2CRecording) UnmarshalJSON(data []byte) error {
+	var rec i2cRecordingJSON
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	raw, err := hex.DecodeString(rec.Data)
+	if err != nil {
+		return fmt.Errorf("I2C recording data %q is not hex: %v", rec.Data, err)
+	}
+	r.Timestamp = rec.Timestamp
+	r.Data = raw
+	return nil
+}
+
+// I2CPollOption configures optional behaviour of an I2CPoll
+type I2CPollOption func(*i2cPollConfig)
+
+type i2cPollConfig struct {
+	attempts int
+	backoff  time.Duration
+	maxage   time.Duration
+	trigger  <-chan struct{}
+	// the flags the bus device is opened with, and the time to read all of a sample
+	flags       int
+	readtimeout time.Duration
+}
+
+// I2CPollRetry makes the poller retry reads that fail with a transient error (EAGAIN, EIO, etc.) instead of stopping.
+// Each sample is attempted up to attempts times in total, waiting backoff before the first retry, and doubling the wait
+// before each subsequent one. The poller only stops once the retries for a sample are exhausted.
+// Without this option a poller stops on the first read error.
+func I2CPollRetry(attempts int, backoff time.Duration) I2CPollOption {
+	return func(cfg *i2cPollConfig) {
+		cfg.attempts = attempts
+		cfg.backoff = backoff
+	}
+}
+
+// I2CPollMaxAge limits how old a sample can be when it is received from an unbuffered poller. A sample that is still
+// waiting for a receiver when it gets older than maxAge is replaced by a fresh, synchronous read, and a receiver that
+// asks during that read waits for it (the time of an I2C read, plus any retries). Note that while nobody receives,
+// this reads the device every maxAge, not only every interval.
+// Without this option a sample can be as old as the poll interval.
+func I2CPollMaxAge(maxAge time.Duration) I2CPollOption {
+	return func(cfg *i2cPollConfig) {
+		cfg.maxage = maxAge
+	}
+}
+
+// I2CPollOnDemand makes the poller read the device when a value is received on the trigger channel, for example when
+// a GPIO interrupt signals that data is ready, instead of on a ticker. The interval becomes the minimum time between
+// reads: a trigger sooner than that is delayed until the interval passes, and triggers while one is delayed are
+// combined with it. Only the samples of triggered reads are sent. Closing the trigger stops the poller.
+// This can not be combined with I2CPollMaxAge(...), which reads without a trigger.
+func I2CPollOnDemand(trigger <-chan struct{}) I2CPollOption {
+	return func(cfg *i2cPollConfig) {
+		cfg.trigger = trigger
+	}
+}
+
+// I2CPollNonBlocking opens the bus device non-blocking, so a read of a device that is not ready fails with EAGAIN
+// instead of waiting in the kernel, and is repeated until the sample is read, or the timeout (0 for
+// DefaultI2CReadTimeout) passes. A sample read that returns fewer bytes than asked for, for example from a device
+// that stretches the clock, is completed by further reads within the same timeout, with or without this option.
+func I2CPollNonBlocking(timeout time.Duration) I2CPollOption {
+	return func(cfg *i2cPollConfig) {
+		cfg.flags |= syscall.O_NONBLOCK
+		cfg.readtimeout = timeout
+	}
+}
+
+// isTransientI2C returns true if the error is one that a noisy bus or busy device can produce, and may work if retried
+func isTransientI2C(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	switch err {
+	case syscall.EAGAIN, syscall.EIO, syscall.ETIMEDOUT, syscall.EREMOTEIO, syscall.ENXIO:
+		return true
+	}
+	return false
+}
+
+// errI2CStopped is returned by a read that was abandoned because the poller was stopped, which is not a failure
+var errI2CStopped = errors.New("I2C poll stopped")
+
+// read reads a sample from the device, retrying transient failures according to the configuration.
+// The retries are abandoned, with errI2CStopped, if the killer is signalled.
+func (cfg *i2cPollConfig) read(ctrl io.Reader, buffer []byte, killer <-chan bool) (int, error) {
+	wait := cfg.backoff
+	for attempt := 1; ; attempt++ {
+		n, err := readFull(ctrl, buffer, cfg.readtimeout, killer)
+		if err == nil || attempt >= cfg.attempts || !isTransientI2C(err) {
+			return n, err
+		}
+		warn("I2C Retrying read of %v after attempt %v failed: %v\n", ctrl, attempt, err)
+		select {
+		case <-killer:
+			return n, errI2CStopped
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// readFull reads until the buffer is full, repeating short reads and reads that fail with EAGAIN (of a non-blocking
+// device) until the timeout passes, or the killer is signalled, which returns errI2CStopped
+func readFull(r io.Reader, buffer []byte, timeout time.Duration, killer <-chan bool) (int, error) {
+	deadline := time.Now().Add(timeout)
+	n := 0
+	for {
+		got, err := r.Read(buffer[n:])
+		n += got
+		if n == len(buffer) {
+			return n, nil
+		}
+		if err != nil && !isAgain(err) {
+			return n, err
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("I2C read of %v bytes returned %v within %v", len(buffer), n, timeout)
+			}
+			return n, err
+		}
+		select {
+		case <-killer:
+			return n, errI2CStopped
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+// isAgain returns true if the error is the one a non-blocking read gives when the device is not ready
+func isAgain(err error) bool {
+	if pe, ok := err.(*os.PathError); ok {
+		err = pe.Err
+	}
+	return err == syscall.EAGAIN
+}
+
 func copyBytes(buffer []byte, count int) []byte {
 	ret := make([]byte, count)
 	copy(ret, buffer)
@@ -51,13 +425,42 @@ func copyBytes(buffer []byte, count int) []byte {
 // The dev, address, and bytes parameters indicates which device to read and how much to read each time.
 // The bufferdepth determines how deep the returned channel's buffer is.
 // All samples taken after the buffer is filled will be discarded until space is available.
-// An unbuffered return is supported, and guarantees that a receive on that channel gets the most recent sample.
-// The interval indicates the period to sample at.
+// An unbuffered return is supported, and guarantees that a receive on that channel gets the most recent sample,
+// which can be as old as the interval, see I2CPollMaxAge(...) for fresher samples.
+// The interval indicates the period to sample at, or the minimum time between reads with I2CPollOnDemand(...).
 // The returned channel will be closed if there's an error reading the device or the poller is closed using the returned termination function.
 // Call the termination function returned when you no longer need to receive polling data.
-func I2CPoll(dev string, address int, bytes int, bufferdepth int, interval time.Duration) (<-chan I2CRecording, func(), error) {
+// Options, like I2CPollRetry(...), can be added to change the poller's behaviour.
+func I2CPoll(dev string, address int, bytes int, bufferdepth int, interval time.Duration, opts ...I2CPollOption) (<-chan I2CRecording, func(), error) {
 
-	ctrl, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if bytes < 1 {
+		return nil, nil, fmt.Errorf("I2C poll of %v needs to read at least 1 byte, not %v", dev, bytes)
+	}
+	if bufferdepth < 0 {
+		return nil, nil, fmt.Errorf("I2C poll of %v buffer depth %v can not be negative", dev, bufferdepth)
+	}
+	if interval <= 0 {
+		return nil, nil, fmt.Errorf("I2C poll of %v interval %v needs to be positive", dev, interval)
+	}
+
+	cfg := &i2cPollConfig{attempts: 1}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.readtimeout < 0 {
+		return nil, nil, fmt.Errorf("I2C poll of %v read timeout %v can not be negative", dev, cfg.readtimeout)
+	}
+	if cfg.readtimeout == 0 {
+		cfg.readtimeout = DefaultI2CReadTimeout
+	}
+	if cfg.maxage < 0 {
+		return nil, nil, fmt.Errorf("I2C poll of %v maximum sample age %v can not be negative", dev, cfg.maxage)
+	}
+	if cfg.maxage > 0 && cfg.trigger != nil {
+		return nil, nil, fmt.Errorf("I2C poll of %v can not limit the sample age of on-demand reads", dev)
+	}
+
+	ctrl, err := i2cOpen(dev, address, I2CAddress7Bit, cfg.flags)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -65,16 +468,14 @@ func I2CPoll(dev string, address int, bytes int, bufferdepth int, interval time.
 	killer := make(chan bool, 1)
 
 	termfn := func() {
-		killer <- true
-	}
-
-	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(ctrl.Fd()), i2c_SLAVE, uintptr(address))
-	if errno != 0 {
-		return nil, nil, errno
+		select {
+		case killer <- true:
+		default:
+		}
 	}
 
 	buffer := make([]byte, bytes)
-	n, err := ctrl.Read(buffer)
+	n, err := cfg.read(ctrl, buffer, nil)
 	if err != nil {
 		ctrl.Close()
 		return nil, nil, err
@@ -84,17 +485,38 @@ func I2CPoll(dev string, address int, bytes int, bufferdepth int, interval time.
 	data := make(chan I2CRecording, 0)
 	record := I2CRecording{time.Now(), copyBytes(buffer, n)}
 
+	done := startBackground(termfn)
 	go func() {
+		defer done()
 		defer close(data)
 		defer ctrl.Close()
 
-		tick := time.NewTicker(interval)
-		defer tick.Stop()
+		// on demand, the trigger drives the reads instead of the ticker
+		var tick <-chan time.Time
+		if cfg.trigger == nil {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
 
 		var stamp time.Time
 
-		// we do some nil channel tricks to manipulate the select statement. dest is part of that.
+		// we do some nil channel tricks to manipulate the select statement. dest, expire, and delay are part of that.
 		dest := data
+		if cfg.trigger != nil {
+			// only triggered samples are sent
+			dest = nil
+		}
+		var expire <-chan time.Time
+		age := func() {
+			if cfg.maxage > 0 {
+				expire = time.After(cfg.maxage - time.Since(record.Timestamp))
+			}
+		}
+		age()
+		// the time of the last read, and the wait for the interval to pass since then before a triggered read
+		last := record.Timestamp
+		var delay <-chan time.Time
 
 		for {
 			select {
@@ -103,16 +525,42 @@ func I2CPoll(dev string, address int, bytes int, bufferdepth int, interval time.
 			case dest <- record:
 				// disable dest until there's a new record.
 				dest = nil
-			case stamp = <-tick.C:
-				n, err := ctrl.Read(buffer)
-				if err != nil {
-					info("I2C Unexpected error reading %v: %v\n", dev, err)
+				expire = nil
+				continue
+			case stamp = <-tick:
+			case stamp = <-expire:
+				debug("I2C Refreshing sample of %v older than %v\n", dev, cfg.maxage)
+			case _, ok := <-cfg.trigger:
+				if !ok {
+					info("I2C On-demand poll of %v ending, the trigger is closed\n", dev)
 					return
 				}
-				record = I2CRecording{stamp, copyBytes(buffer, n)}
-				// indicate there's data to send and reenable dest.
-				dest = data
+				if delay != nil {
+					// combined with the delayed trigger
+					continue
+				}
+				if wait := interval - time.Since(last); wait > 0 {
+					delay = time.After(wait)
+					continue
+				}
+				stamp = time.Now()
+			case stamp = <-delay:
+				delay = nil
+			}
+			last = stamp
+			n, err := cfg.read(ctrl, buffer, killer)
+			if err == errI2CStopped {
+				// the killer token was taken by the read
+				return
+			}
+			if err != nil {
+				errorf("I2C Unexpected error reading %v: %v\n", dev, err)
+				return
 			}
+			record = I2CRecording{stamp, copyBytes(buffer, n)}
+			// indicate there's data to send and reenable dest.
+			dest = data
+			age()
 		}
 	}()
 
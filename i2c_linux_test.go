@@ -0,0 +1,360 @@
+package gopisysfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestI2CRecordingJSON(t *testing.T) {
+	stamp := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	rec := I2CRecording{Timestamp: stamp, Data: []byte{0x01, 0xab}}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"Timestamp":"2017-03-04T05:06:07Z","Data":"01ab","Value":427}`; string(data) != expect {
+		t.Errorf("Expected %v but got %s", expect, data)
+	}
+	var back I2CRecording
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !back.Timestamp.Equal(stamp) || !bytes.Equal(back.Data, rec.Data) {
+		t.Errorf("Expected a round trip of %v but got %v", rec, back)
+	}
+
+	data, err = json.Marshal(I2CRecording{Timestamp: stamp, Data: make([]byte, 9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"Timestamp":"2017-03-04T05:06:07Z","Data":"000000000000000000"}`; string(data) != expect {
+		t.Errorf("Expected %v but got %s", expect, data)
+	}
+
+	data, err = json.Marshal(I2CRawRecording(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"Timestamp":"2017-03-04T05:06:07Z","Data":"Aas="}`; string(data) != expect {
+		t.Errorf("Expected %v but got %s", expect, data)
+	}
+}
+
+func TestI2CValidation(t *testing.T) {
+	// the arguments are checked before the device is opened
+	dev := "/dev/i2c-nonexistent"
+	for _, tc := range []struct {
+		address int
+		mode    I2CAddressMode
+		ok      bool
+	}{
+		{0x08, I2CAddress7Bit, true},
+		{0x77, I2CAddress7Bit, true},
+		{0x00, I2CAddress7Bit, false},
+		{0x78, I2CAddress7Bit, false},
+		{0x80, I2CAddress7Bit, false},
+		{-1, I2CAddress7Bit, false},
+		{0x000, I2CAddress10Bit, true},
+		{0x3ff, I2CAddress10Bit, true},
+		{0x400, I2CAddress10Bit, false},
+		{0x50, I2CAddressMode(3), false},
+	} {
+		err := checkI2CAddress(tc.address, tc.mode)
+		if tc.ok != (err == nil) {
+			t.Errorf("Unexpected result for address 0x%x (%v): %v", tc.address, tc.mode, err)
+		}
+	}
+	if _, err := I2COpen(dev, 0x78, I2CAddress7Bit); err == nil || !strings.Contains(err.Error(), "0x08 to 0x77") {
+		t.Errorf("Expected an error naming the valid range, but got %v", err)
+	}
+	for _, bad := range []struct {
+		bytes    int
+		depth    int
+		interval time.Duration
+	}{
+		{0, 1, time.Second},
+		{1, -1, time.Second},
+		{1, 1, 0},
+	} {
+		if _, _, err := I2CPoll(dev, 0x50, bad.bytes, bad.depth, bad.interval); err == nil || os.IsNotExist(err) {
+			t.Errorf("Expected a parameter error for %+v but got %v", bad, err)
+		}
+	}
+	for _, msg := range []I2CMessage{
+		{Address: -1, Buf: []byte{0}},
+		{Address: 0x10050, Buf: []byte{0}},
+		{Address: 0x78, Buf: []byte{0}},
+		{Address: 0x150, Buf: []byte{0}},
+		{Address: 0x400, Flags: I2CMsgTenBit, Buf: []byte{0}},
+	} {
+		if err := I2CTransfer(dev, []I2CMessage{msg}); err == nil || os.IsNotExist(err) {
+			t.Errorf("Expected an address error for %+v but got %v", msg, err)
+		}
+	}
+	if err := I2CTransfer(dev, []I2CMessage{{Address: 0x150, Flags: I2CMsgTenBit, Buf: []byte{0}}}); !os.IsNotExist(err) {
+		t.Errorf("Expected a valid 10-bit address to reach the device, but got %v", err)
+	}
+	_, _, err := I2CPoll(dev, 0x50, 1, 0, time.Second, I2CPollMaxAge(time.Millisecond), I2CPollOnDemand(make(chan struct{})))
+	if err == nil || os.IsNotExist(err) {
+		t.Errorf("Expected an error limiting the age of on-demand samples but got %v", err)
+	}
+}
+
+func TestI2CFuncs(t *testing.T) {
+	// the functionality of the bcm2835 adapter, which has no 10-bit addresses or SMBus block data
+	bcm2835 := I2CFuncI2C | I2CFuncSMBusPEC | I2CFuncSMBusQuick | I2CFuncSMBusReadByte | I2CFuncSMBusWriteByte |
+		I2CFuncSMBusReadByteData | I2CFuncSMBusWriteByteData | I2CFuncSMBusReadWordData | I2CFuncSMBusWriteWordData |
+		I2CFuncSMBusProcCall | I2CFuncSMBusReadI2CBlock | I2CFuncSMBusWriteI2CBlock
+	for _, tc := range []struct {
+		funcs  I2CFuncs
+		expect [7]bool
+	}{
+		{0, [7]bool{}},
+		{bcm2835, [7]bool{true, false, true, true, true, false, true}},
+		{I2CFunc10BitAddr | I2CFuncSMBusReadBlockData | I2CFuncSMBusWriteBlockData, [7]bool{false, true, false, false, false, true, false}},
+		// a read without the write is not enough
+		{I2CFuncSMBusReadByte | I2CFuncSMBusReadWordData | I2CFuncSMBusReadI2CBlock, [7]bool{}},
+		{^I2CFuncs(0), [7]bool{true, true, true, true, true, true, true}},
+	} {
+		f := tc.funcs
+		got := [7]bool{f.SupportsI2C(), f.Supports10Bit(), f.SupportsSMBusByte(), f.SupportsSMBusByteData(),
+			f.SupportsSMBusWordData(), f.SupportsSMBusBlock(), f.SupportsI2CBlock()}
+		if got != tc.expect {
+			t.Errorf("Expected functions 0x%08x to support %v but got %v", uint64(f), tc.expect, got)
+		}
+	}
+	if !bcm2835.Has(I2CFuncI2C|I2CFuncSMBusQuick) || bcm2835.Has(I2CFuncI2C|I2CFunc10BitAddr) || !bcm2835.Has(0) {
+		t.Errorf("Expected Has to need every function in the mask")
+	}
+
+	if _, err := I2CFunctions("/dev/i2c-nonexistent"); !os.IsNotExist(err) {
+		t.Errorf("Expected a missing device error but got %v", err)
+	}
+	// a file that is not a bus device rejects the query
+	if _, err := I2CFunctions(file(proc_cpuinfo)); err == nil {
+		t.Errorf("Expected an error querying the functions of a plain file")
+	}
+}
+
+func TestI2CListDevices(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-1"), nil)
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-2"), nil)
+	fs.AddFile(filepath.Join(dev_root, "i2c-1"), nil)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	devs, err := I2CListDevices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 1 || devs[0] != file(dev_root, "i2c-1") {
+		t.Errorf("Expected only the bus with a device node but got %v", devs)
+	}
+}
+
+func TestThresholdCrossings(t *testing.T) {
+	records := make(chan I2CRecording)
+	crossings := make(chan I2CCrossing, 10)
+	go thresholdCrossings(records, crossings, func(data []byte) float64 { return float64(data[0]) }, 10, 20)
+
+	for _, v := range []byte{25, 15, 9, 12, 19, 20, 21, 11, 10, 5, 15} {
+		records <- I2CRecording{Timestamp: time.Now(), Data: []byte{v}}
+	}
+	close(records)
+
+	got := []I2CCrossing{}
+	for crossing := range crossings {
+		got = append(got, crossing)
+	}
+	expect := []struct {
+		value  float64
+		rising bool
+	}{{9, false}, {20, true}, {10, false}}
+	if len(got) != len(expect) {
+		t.Fatalf("Expected %v crossings but got %+v", len(expect), got)
+	}
+	for i, e := range expect {
+		if got[i].Value != e.value || got[i].Rising != e.rising {
+			t.Errorf("Expected crossing %v to be %+v but got %+v", i, e, got[i])
+		}
+	}
+}
+
+func TestI2CListAdapters(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-11", "name"), []byte("i2c-gpio-mux\n"))
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-1", "name"), []byte("bcm2835 (i2c@7e804000)\n"))
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-2", "name"), []byte("bcm2835 (i2c@7e805000)\n"))
+	fs.AddFile(filepath.Join(dev_root, "i2c-1"), nil)
+	fs.AddFile(filepath.Join(dev_root, "i2c-11"), nil)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	adapters, err := I2CListAdapters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []I2CAdapter{
+		{Bus: 1, DevPath: file(dev_root, "i2c-1"), Name: "bcm2835 (i2c@7e804000)"},
+		{Bus: 11, DevPath: file(dev_root, "i2c-11"), Name: "i2c-gpio-mux"},
+	}
+	if len(adapters) != len(expect) {
+		t.Fatalf("Expected adapters %+v but got %+v", expect, adapters)
+	}
+	for i := range expect {
+		if adapters[i] != expect[i] {
+			t.Errorf("Expected adapter %+v but got %+v", expect[i], adapters[i])
+		}
+	}
+}
+
+func TestI2CBusSpeed(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-1", "device", "of_node", "clock-frequency"), []byte{0x00, 0x06, 0x1a, 0x80})
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-11", "name"), []byte("i2c-gpio-mux\n"))
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	if hz, err := I2CBusSpeed("/dev/i2c-1"); err != nil || hz != 400000 {
+		t.Errorf("Expected a 400000Hz bus but got %v: %v", hz, err)
+	}
+	if _, err := I2CBusSpeed("/dev/i2c-11"); err != ErrNoI2CBusSpeed {
+		t.Errorf("Expected ErrNoI2CBusSpeed but got %v", err)
+	}
+}
+
+// failReader fails every read with the error
+type failReader struct {
+	err error
+}
+
+func (r failReader) Read(buffer []byte) (int, error) {
+	return 0, r.err
+}
+
+func TestI2CReadStopped(t *testing.T) {
+	cfg := &i2cPollConfig{attempts: 3, backoff: time.Hour}
+	killer := make(chan bool, 1)
+	killer <- true
+	eio := &os.PathError{Op: "read", Path: "/dev/i2c-1", Err: syscall.EIO}
+	if _, err := cfg.read(failReader{eio}, make([]byte, 1), killer); err != errI2CStopped {
+		t.Errorf("Expected a stop during the retry backoff to be reported as stopped, but got %v", err)
+	}
+	cfg.attempts = 1
+	if _, err := cfg.read(failReader{eio}, make([]byte, 1), nil); err != eio {
+		t.Errorf("Expected the read error without retries, but got %v", err)
+	}
+}
+
+// chunkReader returns its data a few bytes at a time, failing with EAGAIN before each chunk
+type chunkReader struct {
+	data  []byte
+	chunk int
+	again bool
+}
+
+func (r *chunkReader) Read(buffer []byte) (int, error) {
+	if r.again = !r.again; r.again {
+		return 0, &os.PathError{Op: "read", Path: "/dev/i2c-1", Err: syscall.EAGAIN}
+	}
+	end := r.chunk
+	if end > len(r.data) {
+		end = len(r.data)
+	}
+	n := copy(buffer, r.data[:end])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReadFull(t *testing.T) {
+	buffer := make([]byte, 5)
+	n, err := readFull(&chunkReader{data: []byte{1, 2, 3, 4, 5, 6}, chunk: 2}, buffer, time.Second, nil)
+	if err != nil || n != 5 || string(buffer) != string([]byte{1, 2, 3, 4, 5}) {
+		t.Errorf("Expected the short reads to be completed but got %v %v: %v", n, buffer, err)
+	}
+
+	n, err = readFull(&chunkReader{data: []byte{1, 2}, chunk: 2}, buffer, 10*time.Millisecond, nil)
+	if err == nil || n != 2 {
+		t.Errorf("Expected a read that stays short to time out, but got %v: %v", n, err)
+	}
+
+	killer := make(chan bool, 1)
+	killer <- true
+	cfg := &i2cPollConfig{attempts: 3, readtimeout: time.Hour}
+	if _, err := cfg.read(&chunkReader{data: []byte{1, 2}, chunk: 2}, buffer, killer); err != errI2CStopped {
+		t.Errorf("Expected a stop during a short read to be reported as stopped, but got %v", err)
+	}
+}
+
+func TestI2CMux(t *testing.T) {
+	// the arguments are checked before the device is opened
+	dev := "/dev/i2c-nonexistent"
+	if _, err := I2COpenMux(dev, 0x78); err == nil {
+		t.Errorf("Expected an error for a mux at a reserved address")
+	}
+	mux, err := I2COpenMux(dev, 0x70)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := I2COpenMux(dev, 0x70)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mux.lock != other.lock {
+		t.Errorf("Expected muxes at the same address to share a lock")
+	}
+	if mux.lock == i2cMuxLock(dev, 0x71) {
+		t.Errorf("Expected muxes at different addresses to have their own lock")
+	}
+	for _, channel := range []int{-1, I2CMuxChannels} {
+		if err := mux.SelectChannel(channel); err == nil || os.IsNotExist(err) {
+			t.Errorf("Expected a channel error for %v but got %v", channel, err)
+		}
+	}
+	called := false
+	err = mux.Transact(0, func() error {
+		called = true
+		return nil
+	})
+	if err == nil || called {
+		t.Errorf("Expected the transaction to not run when the channel can not be selected, but got %v", err)
+	}
+}
+
+func TestI2CListDevicesWait(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-1"), nil)
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-2"), nil)
+	fs.AddFile(filepath.Join(dev_root, "i2c-1"), nil)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fs.AddFile(filepath.Join(dev_root, "i2c-2"), nil)
+	}()
+	devs, err := I2CListDevices(I2CListWait(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 2 || devs[1] != file(dev_root, "i2c-2") {
+		t.Errorf("Expected the bus whose device node appeared during the wait, but got %v", devs)
+	}
+
+	fs.AddFile(filepath.Join(sys_i2c, "i2c-3"), nil)
+	start := time.Now()
+	devs, err = I2CListDevices(I2CListWait(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devs) != 2 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Expected the bus without a device node to be left out after the wait, but got %v", devs)
+	}
+}
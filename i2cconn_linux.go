@@ -0,0 +1,293 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	i2c_TENBIT = 0x704
+	i2c_RDWR   = 0x707
+
+	// the kernel limits the number of messages in a single I2C_RDWR transfer
+	i2c_RDWR_MAX = 42
+)
+
+// I2CMessageFlags control how each message in an I2CTransfer is performed
+type I2CMessageFlags uint16
+
+const (
+	// I2CMsgRead makes the message read in to its buffer, instead of writing from it
+	I2CMsgRead I2CMessageFlags = 0x0001
+	// I2CMsgTenBit makes the message address a 10-bit address
+	I2CMsgTenBit I2CMessageFlags = 0x0010
+	// I2CMsgNoStart omits the (repeated) start condition before the message, if the adapter supports it
+	I2CMsgNoStart I2CMessageFlags = 0x4000
+)
+
+// I2CMessage is a single read or write in a combined I2CTransfer
+type I2CMessage struct {
+	Address int
+	Flags   I2CMessageFlags
+	Buf     []byte
+}
+
+// i2cMsg matches the kernel's struct i2c_msg
+type i2cMsg struct {
+	addr  uint16
+	flags uint16
+	len   uint16
+	buf   uintptr
+}
+
+// i2cRdwrData matches the kernel's struct i2c_rdwr_ioctl_data
+type i2cRdwrData struct {
+	msgs  uintptr
+	nmsgs uint32
+}
+
+// I2CAddressMode indicates how a slave address is interpreted on the I2C bus
+type I2CAddressMode int
+
+const (
+	// I2CAddress7Bit is the common 7-bit slave address, 0x00 to 0x7f
+	I2CAddress7Bit I2CAddressMode = iota
+	// I2CAddress10Bit is the extended 10-bit slave address, 0x000 to 0x3ff
+	I2CAddress10Bit
+)
+
+func (m I2CAddressMode) String() string {
+	switch m {
+	case I2CAddress7Bit:
+		return "7-bit"
+	case I2CAddress10Bit:
+		return "10-bit"
+	}
+	return fmt.Sprintf("I2CAddressMode(%d)", int(m))
+}
+
+// i2cBuses holds a lock for each bus device, keyed by the device path, so that the transactions this process makes
+// on a bus are serialized, while different buses stay parallel.
+var i2cBuses = struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}{
+	locks: make(map[string]*sync.Mutex),
+}
+
+// i2cBusLock returns the lock for the bus device
+func i2cBusLock(dev string) *sync.Mutex {
+	i2cBuses.mu.Lock()
+	defer i2cBuses.mu.Unlock()
+
+	dev = filepath.Clean(dev)
+	lock, ok := i2cBuses.locks[dev]
+	if !ok {
+		lock = &sync.Mutex{}
+		i2cBuses.locks[dev] = lock
+	}
+	return lock
+}
+
+// I2CConn is an open connection to a single slave device on an I2C bus.
+// It implements io.ReadWriteCloser, with each Read or Write being a single I2C transaction.
+// Transactions on the same bus device, from any connection or I2CTransfer, are serialized, and it is safe to
+// use a connection from multiple goroutines. The lock protects the bus, not the state of the device: a sequence
+// of transactions that has to be made without interruption needs a single I2CTransfer, or locking by the caller.
+type I2CConn struct {
+	dev     string
+	address int
+	mode    I2CAddressMode
+	ctrl    *os.File
+	bus     *sync.Mutex
+}
+
+// checkI2CAddress validates a slave address. 7-bit addresses 0x00 to 0x07 and 0x78 to 0x7f are reserved by the
+// I2C specification (general call, CBUS, high-speed mode, 10-bit addressing, etc.), and are not slave devices.
+func checkI2CAddress(address int, mode I2CAddressMode) error {
+	switch mode {
+	case I2CAddress7Bit:
+		if address < 0 || address > 0x7f {
+			return fmt.Errorf("I2C address 0x%x is out of range for a %v address (0x08 to 0x77)", address, mode)
+		}
+		if address < 0x08 || address > 0x77 {
+			return fmt.Errorf("I2C address 0x%02x is reserved, %v slave addresses are 0x08 to 0x77 (0x00-0x07 and 0x78-0x7f are reserved)", address, mode)
+		}
+	case I2CAddress10Bit:
+		if address < 0 || address > 0x3ff {
+			return fmt.Errorf("I2C address 0x%x is out of range for a %v address (0x000 to 0x3ff)", address, mode)
+		}
+	default:
+		return fmt.Errorf("I2CAddressMode %v does not exist", mode)
+	}
+	return nil
+}
+
+// I2COpen opens the specified I2C bus device (e.g. /dev/i2c-1) and selects the slave at the given address.
+// 7-bit addresses have to be in the slave range 0x08 to 0x77.
+// 10-bit addresses are only available if the adapter supports them (see I2CFunctions).
+func I2COpen(dev string, address int, mode I2CAddressMode) (*I2CConn, error) {
+	return i2cOpen(dev, address, mode, 0)
+}
+
+// i2cOpen is I2COpen, with additional flags for opening the bus device, like O_NONBLOCK
+func i2cOpen(dev string, address int, mode I2CAddressMode, flags int) (*I2CConn, error) {
+
+	if err := checkI2CAddress(address, mode); err != nil {
+		return nil, err
+	}
+
+	bus := i2cBusLock(dev)
+	bus.Lock()
+	defer bus.Unlock()
+
+	ctrl, err := os.OpenFile(dev, os.O_RDWR|flags, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode == I2CAddress10Bit {
+		// the kernel accepts the 10-bit flag regardless, but transfers fail on adapters that can't do it.
+		funcs, err := i2cFunctions(ctrl)
+		if err == nil && !funcs.Supports10Bit() {
+			err = fmt.Errorf("adapter reports no 10-bit support")
+		}
+		if err == nil {
+			err = i2cIoctl(ctrl, i2c_TENBIT, 1)
+		}
+		if err != nil {
+			ctrl.Close()
+			return nil, fmt.Errorf("I2C device %v does not support 10-bit addresses: %v", dev, err)
+		}
+	}
+	if err := i2cIoctl(ctrl, i2c_SLAVE, uintptr(address)); err != nil {
+		ctrl.Close()
+		return nil, err
+	}
+
+	return &I2CConn{
+		dev:     dev,
+		address: address,
+		mode:    mode,
+		ctrl:    ctrl,
+		bus:     bus,
+	}, nil
+}
+
+// String produces a human readable representation of the connection
+func (c *I2CConn) String() string {
+	return fmt.Sprintf("%v@0x%02x", c.dev, c.address)
+}
+
+// Read reads up to len(buffer) bytes from the slave device in a single transaction
+func (c *I2CConn) Read(buffer []byte) (int, error) {
+	c.bus.Lock()
+	defer c.bus.Unlock()
+
+	return c.ctrl.Read(buffer)
+}
+
+// Write writes the data to the slave device in a single transaction
+func (c *I2CConn) Write(data []byte) (int, error) {
+	c.bus.Lock()
+	defer c.bus.Unlock()
+
+	return c.ctrl.Write(data)
+}
+
+// Close releases the bus device
+func (c *I2CConn) Close() error {
+	return c.ctrl.Close()
+}
+
+// I2CRead opens a connection to the slave device, reads the given number of bytes, and closes it again.
+func I2CRead(dev string, address int, mode I2CAddressMode, bytes int) ([]byte, error) {
+	conn, err := I2COpen(dev, address, mode)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	buffer := make([]byte, bytes)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, err
+	}
+	return buffer[:n], nil
+}
+
+// I2CWrite opens a connection to the slave device, writes the data, and closes it again.
+func I2CWrite(dev string, address int, mode I2CAddressMode, data []byte) error {
+	conn, err := I2COpen(dev, address, mode)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(data)
+	return err
+}
+
+// I2CTransfer performs the messages as a single combined transaction on the bus device, with repeated starts
+// between the messages instead of stops. Messages with the I2CMsgRead flag have their Buf filled.
+// This is the primitive needed for register reads (write the register, then read) and other repeated-start devices.
+// The transfer is serialized with the other transactions on the bus device, see I2CConn.
+func I2CTransfer(dev string, msgs []I2CMessage) error {
+	if len(msgs) == 0 || len(msgs) > i2c_RDWR_MAX {
+		return fmt.Errorf("I2C transfer needs between 1 and %v messages, not %v", i2c_RDWR_MAX, len(msgs))
+	}
+
+	kmsgs := make([]i2cMsg, len(msgs))
+	for i, m := range msgs {
+		if len(m.Buf) == 0 || len(m.Buf) > 0xffff {
+			return fmt.Errorf("I2C transfer message %v needs a buffer of 1 to 65535 bytes, not %v", i, len(m.Buf))
+		}
+		mode := I2CAddress7Bit
+		if m.Flags&I2CMsgTenBit != 0 {
+			mode = I2CAddress10Bit
+		}
+		if err := checkI2CAddress(m.Address, mode); err != nil {
+			return fmt.Errorf("I2C transfer message %v has an invalid address: %v", i, err)
+		}
+		kmsgs[i] = i2cMsg{
+			addr:  uint16(m.Address),
+			flags: uint16(m.Flags),
+			len:   uint16(len(m.Buf)),
+			buf:   uintptr(unsafe.Pointer(&m.Buf[0])),
+		}
+	}
+
+	bus := i2cBusLock(dev)
+	bus.Lock()
+	defer bus.Unlock()
+
+	ctrl, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer ctrl.Close()
+
+	data := i2cRdwrData{
+		msgs:  uintptr(unsafe.Pointer(&kmsgs[0])),
+		nmsgs: uint32(len(kmsgs)),
+	}
+	err = i2cIoctl(ctrl, i2c_RDWR, uintptr(unsafe.Pointer(&data)))
+	// the kernel only has uintptr references to the buffers, make sure they are not collected early.
+	runtime.KeepAlive(msgs)
+	runtime.KeepAlive(kmsgs)
+	return err
+}
+
+// i2cIoctl performs an I2C control operation on the open bus device
+func i2cIoctl(ctrl *os.File, request, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, ctrl.Fd(), request, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
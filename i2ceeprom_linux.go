@@ -0,0 +1,155 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// eepromWriteTimeout is the longest to wait for an EEPROM to complete a page write cycle (typically 5ms)
+	eepromWriteTimeout = 100 * time.Millisecond
+	// eepromBlock is the size of the blocks selected by the low slave address bits of an EEPROM with 8-bit addressing
+	eepromBlock = 256
+)
+
+// I2CEEPROMOption configures the addressing of the EEPROM in an I2CDumpEEPROM or I2CLoadEEPROM
+type I2CEEPROMOption func(*i2cEEPROMConfig)
+
+type i2cEEPROMConfig struct {
+	addrbytes int
+	pagesize  int
+}
+
+// I2CEEPROM16Bit makes the memory address a 16-bit address, as used by the 24C32 and larger EEPROMs.
+// Without this option the memory address is 8 bits, with the 256 byte blocks of the 24C04 to 24C16 EEPROMs
+// selected by the low bits of the slave address.
+func I2CEEPROM16Bit() I2CEEPROMOption {
+	return func(cfg *i2cEEPROMConfig) {
+		cfg.addrbytes = 2
+	}
+}
+
+// I2CEEPROMPageSize sets the size of the EEPROM's write page, which writes can not cross (see the data sheet).
+// Without this option the page size is 8 bytes, which is the smallest of the common 24Cxx EEPROMs.
+func I2CEEPROMPageSize(size int) I2CEEPROMOption {
+	return func(cfg *i2cEEPROMConfig) {
+		cfg.pagesize = size
+	}
+}
+
+func newEEPROMConfig(opts []I2CEEPROMOption) (*i2cEEPROMConfig, error) {
+	cfg := &i2cEEPROMConfig{addrbytes: 1, pagesize: 8}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.pagesize < 1 {
+		return nil, fmt.Errorf("I2C EEPROM page size %v needs to be positive", cfg.pagesize)
+	}
+	return cfg, nil
+}
+
+// locate returns the slave address and the memory address bytes of the offset in the EEPROM at the address
+func (cfg *i2cEEPROMConfig) locate(address, offset int) (int, []byte) {
+	if cfg.addrbytes == 2 {
+		return address, []byte{byte(offset >> 8), byte(offset)}
+	}
+	return address + offset/eepromBlock, []byte{byte(offset)}
+}
+
+// check validates that size bytes fit in the EEPROM's address space at the address
+func (cfg *i2cEEPROMConfig) check(address, size int) error {
+	limit := 0x10000
+	if cfg.addrbytes == 1 {
+		// the blocks use up slave addresses, up to the last one that is not reserved
+		limit = (0x78 - address) * eepromBlock
+	}
+	if size < 0 || size > limit {
+		return fmt.Errorf("I2C EEPROM at 0x%02x can not address %v bytes (limit %v)", address, size, limit)
+	}
+	return nil
+}
+
+// writeEnd returns the end of the single write that starts at the offset, of data that ends at size
+func (cfg *i2cEEPROMConfig) writeEnd(offset, size int) int {
+	// writes wrap around within a page, so they must stop at the page boundary
+	end := (offset/cfg.pagesize + 1) * cfg.pagesize
+	if block := (offset/eepromBlock + 1) * eepromBlock; cfg.addrbytes == 1 && end > block {
+		end = block
+	}
+	if end > size {
+		end = size
+	}
+	return end
+}
+
+// I2CDumpEEPROM reads the first size bytes of a 24Cxx style EEPROM at the address on the bus device.
+// Options, like I2CEEPROM16Bit(), describe the EEPROM's addressing.
+func I2CDumpEEPROM(dev string, address int, size int, opts ...I2CEEPROMOption) ([]byte, error) {
+	cfg, err := newEEPROMConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.check(address, size); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	// read in blocks, which never cross the slave address of an 8-bit EEPROM
+	for offset := 0; offset < size; offset += eepromBlock {
+		end := offset + eepromBlock
+		if end > size {
+			end = size
+		}
+		slave, memaddr := cfg.locate(address, offset)
+		err := I2CTransfer(dev, []I2CMessage{
+			{Address: slave, Buf: memaddr},
+			{Address: slave, Flags: I2CMsgRead, Buf: data[offset:end]},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("I2C EEPROM read of %v at 0x%02x offset %v failed: %v", dev, address, offset, err)
+		}
+	}
+	return data, nil
+}
+
+// I2CLoadEEPROM writes the data to the start of a 24Cxx style EEPROM at the address on the bus device, one page at a
+// time, waiting for each page's write cycle to complete. Options, like I2CEEPROMPageSize(...), describe the EEPROM.
+func I2CLoadEEPROM(dev string, address int, data []byte, opts ...I2CEEPROMOption) error {
+	cfg, err := newEEPROMConfig(opts)
+	if err != nil {
+		return err
+	}
+	if err := cfg.check(address, len(data)); err != nil {
+		return err
+	}
+
+	for offset := 0; offset < len(data); {
+		end := cfg.writeEnd(offset, len(data))
+		slave, memaddr := cfg.locate(address, offset)
+		buf := append(memaddr, data[offset:end]...)
+		if err := I2CTransfer(dev, []I2CMessage{{Address: slave, Buf: buf}}); err != nil {
+			return fmt.Errorf("I2C EEPROM write of %v at 0x%02x offset %v failed: %v", dev, address, offset, err)
+		}
+		if err := awaitEEPROMWrite(dev, slave, memaddr); err != nil {
+			return err
+		}
+		offset = end
+	}
+	return nil
+}
+
+// awaitEEPROMWrite waits for the EEPROM to complete a write cycle, which it signals by acknowledging its address again
+func awaitEEPROMWrite(dev string, slave int, memaddr []byte) error {
+	deadline := time.Now().Add(eepromWriteTimeout)
+	for {
+		// setting the memory address does not write anything, but is only acknowledged once the write cycle is done
+		err := I2CTransfer(dev, []I2CMessage{{Address: slave, Buf: memaddr}})
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("I2C EEPROM at 0x%02x on %v did not complete a write within %v: %v", slave, dev, eepromWriteTimeout, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,100 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestEEPROMConfig(t *testing.T) {
+	cfg, err := newEEPROMConfig(nil)
+	if err != nil || cfg.addrbytes != 1 || cfg.pagesize != 8 {
+		t.Errorf("Expected 8-bit addressing with 8 byte pages, but got %+v: %v", cfg, err)
+	}
+	if _, err := newEEPROMConfig([]I2CEEPROMOption{I2CEEPROMPageSize(0)}); err == nil {
+		t.Errorf("Expected an error for an empty page")
+	}
+	cfg, err = newEEPROMConfig([]I2CEEPROMOption{I2CEEPROM16Bit(), I2CEEPROMPageSize(32)})
+	if err != nil || cfg.addrbytes != 2 || cfg.pagesize != 32 {
+		t.Errorf("Expected 16-bit addressing with 32 byte pages, but got %+v: %v", cfg, err)
+	}
+}
+
+func TestEEPROMLocate(t *testing.T) {
+	for _, tc := range []struct {
+		addrbytes int
+		offset    int
+		slave     int
+		memaddr   []byte
+	}{
+		{1, 0x000, 0x50, []byte{0x00}},
+		{1, 0x0ff, 0x50, []byte{0xff}},
+		{1, 0x100, 0x51, []byte{0x00}},
+		{1, 0x7ff, 0x57, []byte{0xff}},
+		{2, 0x0000, 0x50, []byte{0x00, 0x00}},
+		{2, 0x0100, 0x50, []byte{0x01, 0x00}},
+		{2, 0x1234, 0x50, []byte{0x12, 0x34}},
+	} {
+		cfg := &i2cEEPROMConfig{addrbytes: tc.addrbytes, pagesize: 8}
+		slave, memaddr := cfg.locate(0x50, tc.offset)
+		if slave != tc.slave || fmt.Sprint(memaddr) != fmt.Sprint(tc.memaddr) {
+			t.Errorf("Expected offset 0x%x with %v address bytes at 0x%02x % x, but got 0x%02x % x",
+				tc.offset, tc.addrbytes, tc.slave, tc.memaddr, slave, memaddr)
+		}
+	}
+}
+
+func TestEEPROMCheck(t *testing.T) {
+	for _, tc := range []struct {
+		addrbytes int
+		address   int
+		size      int
+		ok        bool
+	}{
+		{1, 0x50, 0, true},
+		{1, 0x50, -1, false},
+		{1, 0x50, 2048, true},
+		// the blocks of an 8-bit EEPROM use the slave addresses up to 0x77
+		{1, 0x50, (0x78 - 0x50) * 256, true},
+		{1, 0x50, (0x78-0x50)*256 + 1, false},
+		{1, 0x77, 256, true},
+		{1, 0x77, 257, false},
+		{2, 0x50, 0x10000, true},
+		{2, 0x50, 0x10001, false},
+		{2, 0x77, 0x10000, true},
+	} {
+		cfg := &i2cEEPROMConfig{addrbytes: tc.addrbytes, pagesize: 8}
+		if err := cfg.check(tc.address, tc.size); tc.ok != (err == nil) {
+			t.Errorf("Unexpected result for %v bytes at 0x%02x with %v address bytes: %v", tc.size, tc.address, tc.addrbytes, err)
+		}
+	}
+}
+
+func TestEEPROMWriteEnd(t *testing.T) {
+	for _, tc := range []struct {
+		addrbytes int
+		pagesize  int
+		offset    int
+		size      int
+		end       int
+	}{
+		// writes stop at the page boundary
+		{1, 16, 0, 100, 16},
+		{1, 16, 10, 100, 16},
+		{1, 16, 16, 100, 32},
+		// and at the end of the data
+		{1, 16, 0, 5, 5},
+		{1, 16, 96, 100, 100},
+		// a page that does not divide the 256 byte blocks of a 24C04 to 24C16 stops at the block
+		{1, 24, 240, 1000, 256},
+		{1, 24, 256, 1000, 264},
+		{1, 512, 0, 1000, 256},
+		// 16-bit addressing has no blocks
+		{2, 24, 240, 1000, 264},
+		{2, 512, 0, 1000, 512},
+	} {
+		cfg := &i2cEEPROMConfig{addrbytes: tc.addrbytes, pagesize: tc.pagesize}
+		if end := cfg.writeEnd(tc.offset, tc.size); end != tc.end {
+			t.Errorf("Expected the write at %v of %v bytes (%+v) to end at %v, but got %v", tc.offset, tc.size, cfg, tc.end, end)
+		}
+	}
+}
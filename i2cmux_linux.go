@@ -0,0 +1,124 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// I2CMuxChannels is the number of downstream channels of a PCA9548A/TCA9548A I2C multiplexer
+const I2CMuxChannels = 8
+
+// i2cMuxes holds a lock for each multiplexer, keyed by the bus device path and address, so that every I2CMux for
+// the same multiplexer serializes the channel selections and the transactions that depend on them.
+var i2cMuxes = struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}{
+	locks: make(map[string]*sync.Mutex),
+}
+
+// i2cMuxLock returns the lock for the multiplexer at the address on the bus device
+func i2cMuxLock(dev string, address int) *sync.Mutex {
+	i2cMuxes.mu.Lock()
+	defer i2cMuxes.mu.Unlock()
+
+	key := fmt.Sprintf("%v@0x%02x", filepath.Clean(dev), address)
+	lock, ok := i2cMuxes.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		i2cMuxes.locks[key] = lock
+	}
+	return lock
+}
+
+// I2CMux is a PCA9548A/TCA9548A style I2C multiplexer, which connects the downstream channels whose bits are set in
+// its control register to the bus. The mux only switches channels after the stop condition of the write to the
+// control register, so the selection can not be combined with a downstream transfer in a single I2CTransfer. Instead,
+// Transact and Transfer select the channel, and talk to the downstream device, while holding the mux's lock, so that
+// concurrent access to devices on different channels is serialized. Devices on an unselected channel can not be
+// reached, and accessing them without the mux's lock races with the selections of other goroutines.
+type I2CMux struct {
+	dev     string
+	address int
+	lock    *sync.Mutex
+}
+
+// I2COpenMux returns the multiplexer at the 7-bit address (0x70 to 0x77 for a TCA9548A) on the bus device.
+// No transaction is made until a channel is selected.
+func I2COpenMux(dev string, address int) (*I2CMux, error) {
+	if err := checkI2CAddress(address, I2CAddress7Bit); err != nil {
+		return nil, err
+	}
+	return &I2CMux{
+		dev:     dev,
+		address: address,
+		lock:    i2cMuxLock(dev, address),
+	}, nil
+}
+
+// String produces a human readable representation of the multiplexer
+func (m *I2CMux) String() string {
+	return fmt.Sprintf("%v@0x%02x mux", m.dev, m.address)
+}
+
+// selectChannels writes the control register, and needs to be called with the mux locked
+func (m *I2CMux) selectChannels(mask byte) error {
+	if err := I2CTransfer(m.dev, []I2CMessage{{Address: m.address, Buf: []byte{mask}}}); err != nil {
+		return fmt.Errorf("I2C %v unable to select channels 0x%02x: %v", m, mask, err)
+	}
+	return nil
+}
+
+func checkMuxChannel(channel int) error {
+	if channel < 0 || channel >= I2CMuxChannels {
+		return fmt.Errorf("I2C mux channel %v does not exist, channels are 0 to %v", channel, I2CMuxChannels-1)
+	}
+	return nil
+}
+
+// SelectChannel connects only the channel (0 to 7) to the bus. The selection is only held until another goroutine
+// selects a different channel, use Transact or Transfer to talk to a downstream device.
+func (m *I2CMux) SelectChannel(channel int) error {
+	if err := checkMuxChannel(channel); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.selectChannels(1 << uint(channel))
+}
+
+// Deselect disconnects all the channels from the bus
+func (m *I2CMux) Deselect() error {
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.selectChannels(0)
+}
+
+// Transact selects the channel, and calls fn while the channel remains selected, returning fn's error. fn talks to
+// the downstream device with the other I2C functions, like I2CRead or I2CTransfer, on the mux's bus device. It must
+// not use the mux itself, which is locked until fn returns.
+func (m *I2CMux) Transact(channel int, fn func() error) error {
+	if err := checkMuxChannel(channel); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if err := m.selectChannels(1 << uint(channel)); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// Transfer selects the channel, and performs the messages as a single I2CTransfer to the downstream device(s)
+func (m *I2CMux) Transfer(channel int, msgs []I2CMessage) error {
+	return m.Transact(channel, func() error {
+		return I2CTransfer(m.dev, msgs)
+	})
+}
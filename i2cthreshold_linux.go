@@ -0,0 +1,76 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"time"
+)
+
+// I2CCrossing reports a decoded I2C reading that crossed a threshold of an I2CPollThresholds
+type I2CCrossing struct {
+	Timestamp time.Time
+	Value     float64
+	// Rising is true if the reading rose to or above the high threshold, false if it fell to or below the low one
+	Rising bool
+}
+
+// I2CPollThresholds polls the device like I2CPoll, decodes each sample to a value (for example the voltage of an ADC
+// channel), and sends an I2CCrossing only when the value crosses a threshold, instead of every sample. The thresholds
+// have hysteresis: after rising to or above high, the next crossing is falling to or below low, and vice versa, so
+// a value that wavers around one threshold does not produce a stream of events. The first sample only establishes
+// which side the value is on, it is not reported. The returned channel is closed like the I2CPoll one.
+func I2CPollThresholds(dev string, address int, bytes int, interval time.Duration, decode func([]byte) float64, low, high float64, opts ...I2CPollOption) (<-chan I2CCrossing, func(), error) {
+	if decode == nil {
+		return nil, nil, fmt.Errorf("I2C threshold poll of %v needs a decode function", dev)
+	}
+	if low > high {
+		return nil, nil, fmt.Errorf("I2C threshold poll of %v low threshold %v is above the high threshold %v", dev, low, high)
+	}
+
+	records, termfn, err := I2CPoll(dev, address, bytes, 0, interval, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	crossings := make(chan I2CCrossing, DefaultWatchBuffer)
+	done := startBackground(termfn)
+	go func() {
+		defer done()
+		thresholdCrossings(records, crossings, decode, low, high)
+	}()
+
+	return crossings, termfn, nil
+}
+
+// thresholdCrossings sends the crossings of the decoded records until the records are closed, and then closes the crossings
+func thresholdCrossings(records <-chan I2CRecording, crossings chan<- I2CCrossing, decode func([]byte) float64, low, high float64) {
+
+	defer close(crossings)
+
+	// above is nil until the value is known to be on one side of the thresholds
+	var above *bool
+	first := true
+	for record := range records {
+		value := decode(record.Data)
+		var now bool
+		switch {
+		case value >= high && (above == nil || !*above):
+			now = true
+		case value <= low && (above == nil || *above):
+			now = false
+		default:
+			first = false
+			continue
+		}
+		above = &now
+		if first {
+			first = false
+			continue
+		}
+		crossing := I2CCrossing{Timestamp: record.Timestamp, Value: value, Rising: now}
+		select {
+		case crossings <- crossing:
+		default:
+			warn("I2C Threshold dropped crossing %+v: receive channel overflow\n", crossing)
+		}
+	}
+}
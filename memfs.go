@@ -0,0 +1,277 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MemFS is an in-memory FileSystem that simulates the kernel's sysfs GPIO behaviour. Writing a port number
+// to an export file creates the gpioN folder and its control files, and writing to unexport removes them.
+// Use it with SetFileSystem(...) to unit-test code that uses this library without a Pi.
+type MemFS struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	dirs     map[string]bool
+	edgeless map[int]bool
+}
+
+// NewMemFS creates an empty MemFS. Use AddFile and AddGPIOChip to populate it.
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files:    make(map[string][]byte),
+		dirs:     map[string]bool{string(filepath.Separator): true},
+		edgeless: make(map[int]bool),
+	}
+}
+
+// AddFile creates (or replaces) a file with the given content, and any missing parent folders.
+// Relative names are resolved the same way the library resolves sysfs and procfs names.
+func (m *MemFS) AddFile(name string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = file(name)
+	m.mkdirs(filepath.Dir(name))
+	m.files[name] = append([]byte(nil), data...)
+}
+
+// AddGPIOChip creates a gpiochip folder providing ngpio ports from base, along with the export and unexport files.
+func (m *MemFS) AddGPIOChip(base, ngpio int) {
+	chip := file(sys_gpio, fmt.Sprintf("gpiochip%d", base))
+	m.AddFile(filepath.Join(chip, "base"), []byte(fmt.Sprintf("%d\n", base)))
+	m.AddFile(filepath.Join(chip, "ngpio"), []byte(fmt.Sprintf("%d\n", ngpio)))
+	m.AddFile(file(sys_gpio, "export"), nil)
+	m.AddFile(file(sys_gpio, "unexport"), nil)
+}
+
+// SetEdgeless makes the ports export without an edge file, like ports that can not interrupt.
+func (m *MemFS) SetEdgeless(ports ...int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, port := range ports {
+		m.edgeless[port] = true
+	}
+}
+
+// ReadFile returns the content of the named file
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	data, ok := m.files[name]
+	if !ok {
+		if m.dirs[name] {
+			return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+		}
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), data...), nil
+}
+
+// WriteFile replaces the content of the named file, creating it if the folder exists. Writes to the
+// GPIO export, unexport, direction, edge, and value files are validated and applied like sysfs does.
+func (m *MemFS) WriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	if !m.dirs[filepath.Dir(name)] {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	text := strings.TrimSpace(string(data))
+	folder := filepath.Dir(name)
+
+	switch filepath.Base(name) {
+	case "export":
+		return m.export(name, text)
+	case "unexport":
+		return m.unexport(name, text)
+	}
+
+	if !m.isExported(folder) {
+		m.files[name] = append([]byte(nil), data...)
+		return nil
+	}
+
+	switch filepath.Base(name) {
+	case "direction":
+		switch text {
+		case direction_in, direction_out:
+			m.files[name] = []byte(text + "\n")
+		case direction_outlow:
+			m.files[name] = []byte(direction_out + "\n")
+			m.files[filepath.Join(folder, "value")] = []byte(low + "\n")
+		case direction_outhi:
+			m.files[name] = []byte(direction_out + "\n")
+			m.files[filepath.Join(folder, "value")] = []byte(high + "\n")
+		default:
+			return &os.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+		}
+	case "edge":
+		if _, err := parseEdge(text); err != nil {
+			return &os.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+		}
+		m.files[name] = []byte(text + "\n")
+	case "value":
+		if strings.TrimSpace(string(m.files[filepath.Join(folder, "direction")])) != direction_out {
+			return &os.PathError{Op: "write", Path: name, Err: syscall.EPERM}
+		}
+		val := low
+		if n, err := strconv.Atoi(text); err != nil {
+			return &os.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+		} else if n != 0 {
+			val = high
+		}
+		m.files[name] = []byte(val + "\n")
+	case "active_low":
+		val := low
+		if n, err := strconv.Atoi(text); err != nil {
+			return &os.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+		} else if n != 0 {
+			val = high
+		}
+		m.files[name] = []byte(val + "\n")
+	default:
+		m.files[name] = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+// Stat describes the named file or folder
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	if data, ok := m.files[name]; ok {
+		return &memFileInfo{name: filepath.Base(name), size: int64(len(data))}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+// ReadDir describes the contents of the named folder, sorted by name
+func (m *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if !m.dirs[name] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	infos := make([]os.FileInfo, 0)
+	for d := range m.dirs {
+		if d != name && filepath.Dir(d) == name {
+			infos = append(infos, &memFileInfo{name: filepath.Base(d), dir: true})
+		}
+	}
+	for f, data := range m.files {
+		if filepath.Dir(f) == name {
+			infos = append(infos, &memFileInfo{name: filepath.Base(f), size: int64(len(data))})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// export creates the port folder for the port number written to the export file, and needs to be called locked
+func (m *MemFS) export(name, text string) error {
+	port, err := strconv.Atoi(text)
+	if err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+	}
+	folder := filepath.Join(filepath.Dir(name), fmt.Sprintf("gpio%d", port))
+	if m.dirs[folder] {
+		return &os.PathError{Op: "write", Path: name, Err: syscall.EBUSY}
+	}
+	m.dirs[folder] = true
+	m.files[filepath.Join(folder, "direction")] = []byte(direction_in + "\n")
+	m.files[filepath.Join(folder, "value")] = []byte(low + "\n")
+	if !m.edgeless[port] {
+		m.files[filepath.Join(folder, "edge")] = []byte(edge_none + "\n")
+	}
+	m.files[filepath.Join(folder, "active_low")] = []byte(low + "\n")
+	return nil
+}
+
+// unexport removes the port folder for the port number written to the unexport file, and needs to be called locked
+func (m *MemFS) unexport(name, text string) error {
+	port, err := strconv.Atoi(text)
+	if err != nil {
+		return &os.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+	}
+	folder := filepath.Join(filepath.Dir(name), fmt.Sprintf("gpio%d", port))
+	if !m.dirs[folder] {
+		return &os.PathError{Op: "write", Path: name, Err: syscall.EINVAL}
+	}
+	delete(m.dirs, folder)
+	for f := range m.files {
+		if filepath.Dir(f) == folder {
+			delete(m.files, f)
+		}
+	}
+	return nil
+}
+
+// isExported returns true if the folder is a port folder created by an export, and needs to be called locked
+func (m *MemFS) isExported(folder string) bool {
+	_, ok := m.files[filepath.Join(filepath.Dir(folder), "export")]
+	return ok && strings.HasPrefix(filepath.Base(folder), "gpio") && !strings.HasPrefix(filepath.Base(folder), "gpiochip")
+}
+
+// mkdirs creates the folder and any missing parents, and needs to be called locked
+func (m *MemFS) mkdirs(dir string) {
+	for !m.dirs[dir] {
+		m.dirs[dir] = true
+		dir = filepath.Dir(dir)
+	}
+}
+
+// memFileInfo describes a MemFS file or folder
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i *memFileInfo) Name() string {
+	return i.name
+}
+
+func (i *memFileInfo) Size() int64 {
+	return i.size
+}
+
+func (i *memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i *memFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (i *memFileInfo) IsDir() bool {
+	return i.dir
+}
+
+func (i *memFileInfo) Sys() interface{} {
+	return nil
+}
@@ -0,0 +1,84 @@
+package gopisysfs
+
+import (
+	"testing"
+)
+
+func TestMemFSPort(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	if !availableGPIO[testoutport] {
+		t.Fatalf("Expected port %v to be available from the MemFS chip", testoutport)
+	}
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := port.SetValue(true); err == nil {
+		t.Errorf("Expected an error setting the value of an input")
+	}
+	if err := port.SetMode(GPIOOutputHigh); err != nil {
+		t.Fatal(err)
+	}
+	state, err := port.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := PortState{Enabled: true, Direction: GPIOOutput, Value: true, Edge: GPIOEdgeNone}
+	if state != expect {
+		t.Errorf("Expected state %+v but got %+v", expect, state)
+	}
+	values, err := port.Values(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-values; !got.Value {
+		t.Errorf("Expected the polled value of the MemFS port to be high")
+	}
+
+	if err := port.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if port.IsEnabled() {
+		t.Errorf("Expected port %v to be reset", testoutport)
+	}
+}
+
+func TestMemFSEdgeless(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	fs.SetEdgeless(testinport)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenInput(testinport, GPIOEdgeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	state, err := port.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (PortState{Enabled: true, Direction: GPIOInput, Edge: GPIOEdgeNone}); state != expect {
+		t.Errorf("Expected state %+v but got %+v", expect, state)
+	}
+	if ok, err := port.SupportsInterrupts(); err != nil || ok {
+		t.Errorf("Expected a port without an edge file to not support interrupts, but got %v: %v", ok, err)
+	}
+	if _, err := pi.OpenInput(testinport, GPIOEdgeRising); err == nil {
+		t.Errorf("Expected an error opening a port without an edge file for rising edges")
+	}
+}
@@ -0,0 +1,76 @@
+package gopisysfs
+
+import (
+	"sync/atomic"
+)
+
+// PortMetrics is a snapshot of the activity on a port since it was created, for observability
+type PortMetrics struct {
+	// Writes counts the value and direction writes
+	Writes uint64
+	// Reads counts the value and direction reads from sysfs (not those served from a trusted port's cache)
+	Reads uint64
+	// Errors counts the failed reads and writes
+	Errors uint64
+	// Events counts the events reported by the port's monitors, including any that were dropped
+	Events uint64
+	// MonitorRestarts counts the monitors that a SupervisedWatch re-established
+	MonitorRestarts uint64
+}
+
+// portCounters are updated atomically, so they are cheap to keep, and they are allocated on their own to keep the
+// 64-bit counters aligned on 32-bit platforms. A nil portCounters counts nothing.
+type portCounters struct {
+	writes   uint64
+	reads    uint64
+	errors   uint64
+	events   uint64
+	restarts uint64
+}
+
+// access counts a read or write, and its failure
+func (c *portCounters) access(counter *uint64, err error) {
+	atomic.AddUint64(counter, 1)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+}
+
+func (c *portCounters) write(err error) {
+	if c != nil {
+		c.access(&c.writes, err)
+	}
+}
+
+func (c *portCounters) read(err error) {
+	if c != nil {
+		c.access(&c.reads, err)
+	}
+}
+
+func (c *portCounters) event() {
+	if c != nil {
+		atomic.AddUint64(&c.events, 1)
+	}
+}
+
+func (c *portCounters) restart() {
+	if c != nil {
+		atomic.AddUint64(&c.restarts, 1)
+	}
+}
+
+func (c *portCounters) snapshot() PortMetrics {
+	return PortMetrics{
+		Writes:          atomic.LoadUint64(&c.writes),
+		Reads:           atomic.LoadUint64(&c.reads),
+		Errors:          atomic.LoadUint64(&c.errors),
+		Events:          atomic.LoadUint64(&c.events),
+		MonitorRestarts: atomic.LoadUint64(&c.restarts),
+	}
+}
+
+// Metrics returns a snapshot of the port's counters, which do not need the port lock, so it can be called at any time
+func (p *gport) Metrics() PortMetrics {
+	return p.metrics.snapshot()
+}
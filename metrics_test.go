@@ -0,0 +1,46 @@
+package gopisysfs
+
+import (
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenOutput(testoutport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+	before := port.Metrics()
+
+	if err := port.SetValue(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := port.Value(); err != nil {
+		t.Fatal(err)
+	}
+	if err := port.SetMode(GPIOMode(99)); err == nil {
+		t.Errorf("Expected an error for an invalid mode")
+	}
+	if err := port.SetMode(GPIOInput); err != nil {
+		t.Fatal(err)
+	}
+	if err := port.SetValue(false); err == nil {
+		t.Errorf("Expected an error setting the value of an input")
+	}
+
+	after := port.Metrics()
+	if after.Writes <= before.Writes || after.Reads <= before.Reads {
+		t.Errorf("Expected more reads and writes after %+v but got %+v", before, after)
+	}
+	// the invalid mode is rejected before it is written, but sysfs rejects the write to the input
+	if after.Errors != before.Errors+1 {
+		t.Errorf("Expected one access error after %+v but got %+v", before, after)
+	}
+}
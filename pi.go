@@ -1,19 +1,20 @@
 package gopisysfs
 
 import (
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"regexp"
-	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 )
 
 const (
 	sys_model    = "sys/firmware/devicetree/base/model"
+	sys_compat   = "sys/firmware/devicetree/base/compatible"
 	sys_gpio     = "sys/class/gpio"
 	proc_cpuinfo = "proc/cpuinfo"
 )
@@ -21,9 +22,42 @@ const (
 //Pi contains information describing the Pi model we are running on
 type Pi interface {
 	Model() string
+	ModelType() ModelType
 	Revision() string
-	P1GPIOPorts() []int
-	GetPort(int) (GPIOPort, error)
+	Serial() string
+	ProcessorName() string
+	MemoryMB() int
+	NumCores() int
+	Capabilities() Capabilities
+	Info() PiInfo
+	CPUInfo(field string) string
+	RefreshDetails() error
+	Provider
+	IsP1Port(port int) bool
+	AvailableGPIOPorts() ([]int, error)
+	GetHeaderPort(int) (GPIOPort, error)
+	ReclaimPort(port int) (GPIOPort, error)
+	HeaderSnapshot() ([]PinStatus, error)
+	WriteWord(pins []int, value uint, bits int, opts ...WordOption) error
+	ResetAllOnSignal(sigs ...os.Signal) func()
+	SetDrive(port int, mA int) error
+	SetSlew(port int, limited bool) error
+	OpenOutput(port int, initial bool) (GPIOPort, error)
+	OpenInput(port int, edge GPIOEdge) (GPIOPort, error)
+	ConfigureInputs(specs []InputSpec) error
+	VerifyConfiguration() ([]PinMismatch, error)
+	SelfTest(port int) error
+	GetPortByName(string) (GPIOPort, error)
+	GPIOName(port int) string
+	Header() HeaderType
+	PhysicalToBCM(physical int) (int, error)
+	BCMToPhysical(bcm int) (int, error)
+	WiringPiToBCM(wpi int) (int, error)
+	BCMToWiringPi(bcm int) (int, error)
+	Compatible() []string
+	HATInfo() (*HAT, error)
+	BootloaderVersion() (string, error)
+	FirmwareInfo() (FirmwareInfo, error)
 }
 
 // GetDetails returns the details of the Pi that is currently being run on
@@ -37,14 +71,34 @@ func GetDetailsFor(revision, model string) Pi {
 	return buildPi(revision, model)
 }
 
+// PiInfo is a serializable description of a Pi, for example as JSON
+type PiInfo struct {
+	Model     string
+	Revision  string
+	Serial    string
+	MemoryMB  int
+	NumCores  int
+	Processor string
+	P1Ports   []int
+}
+
 type pi struct {
 	mu            sync.Mutex
 	model         string
 	revision      string
+	serial        string
+	cores         int
+	compatible    []string
 	controllerdir string
 	gpiodir       string
+	header        string
 	gpioports     []int
 	portctrl      map[int]*gport
+	// the cpuinfo the details were read from, if they were detected rather than given to GetDetailsFor
+	detected bool
+	cpuinfo  cpuInfo
+	// the specs of the ports configured by ConfigureInputs, for VerifyConfiguration
+	configured map[int]InputSpec
 }
 
 func init() {
@@ -59,19 +113,21 @@ var onpi bool
 // setOnPi is called from the init() function
 func setOnPi() {
 	// don't use file(...) mechanism here. Need absolute file reference.
-	compat, err := readFile("/sys/firmware/devicetree/base/compatible")
+	compat, err := readDeviceTreeList(filepath.Join("/", sys_compat))
 	if err != nil {
 		return
 	}
 	// brcm matches the broadcom compat mechanism, which almost certainly means we are running on a pi.
-	if regexp.MustCompile(`.*\bbrcm\b.*`).MatchString(compat) {
-		onpi = true
+	for _, c := range compat {
+		if strings.HasPrefix(c, "brcm,") {
+			onpi = true
+		}
 	}
 }
 
-// IsOnPi returns true if this code is (probably) running on a Raspberry Pi.
+// IsOnPi returns true if this code is (probably) running on a Raspberry Pi, and not simulating one.
 func IsOnPi() bool {
-	return onpi
+	return onpi && !isSimulating()
 }
 
 // from http://www.raspberrypi-spy.co.uk/2012/06/simple-guide-to-the-rpi-gpio-header-and-pins/
@@ -125,32 +181,113 @@ func findRevisionMap(revision string) string {
 // getdetails allows only one system inspection to determine the current hardware profile
 var getdetails sync.Once
 
-// initOnce does the legwork for populating the system details
+// initOnce does the legwork for populating the system details. It does not fail on a system that is not a Pi,
+// where the details are just empty.
 func initOnce() {
-	model := readFilePanic(file(sys_model))
-	revision := readRevision()
-	host = buildPi(revision, model)
+	cpuinfo := readCPUInfo()
+	host = buildPi(cpuinfo.field("Revision"), readModel(cpuinfo))
+	host.detected = true
+	host.setCPUInfo(cpuinfo)
+	// not all kernels provide a compatible list, it is OK to have none.
+	if compat, err := readDeviceTreeList(file(sys_compat)); err == nil {
+		host.compatible = compat
+	} else {
+		warn("Unable to read file %v: %v", file(sys_compat), err)
+	}
+}
+
+// cpuInfo holds the fields of the cpuinfo, parsed once, and the number of processors it lists
+type cpuInfo struct {
+	fields     map[string]string
+	processors int
+}
+
+// parseCPUInfo parses the "name : value" lines of the cpuinfo. Fields that are listed for each processor, like
+// "model name", keep the first processor's value. Some older ARM kernels also have a
+// "Processor : ARMv6-compatible processor..." model line, which is not counted as a processor.
+func parseCPUInfo(text string) cpuInfo {
+	cpuinfo := cpuInfo{fields: make(map[string]string)}
+	for _, line := range strings.Split(text, "\n") {
+		colon := strings.Index(line, ":")
+		if colon < 0 {
+			continue
+		}
+		name := strings.TrimSpace(line[:colon])
+		value := strings.TrimSpace(line[colon+1:])
+		if strings.EqualFold(name, "processor") {
+			if _, err := strconv.Atoi(value); err == nil {
+				cpuinfo.processors++
+			}
+		}
+		if _, ok := cpuinfo.fields[name]; !ok {
+			cpuinfo.fields[name] = value
+		}
+	}
+	return cpuinfo
+}
+
+// field returns the value of the named field, like Revision, or an empty string if the cpuinfo has no such line
+func (c cpuInfo) field(name string) string {
+	return c.fields[name]
+}
+
+// readCPUInfo reads and parses the cpuinfo, which has no fields if it can not be read
+func readCPUInfo() cpuInfo {
+	text, err := readFile(file(proc_cpuinfo))
+	if err != nil {
+		warn("Unable to read file %v: %v\n", file(proc_cpuinfo), err)
+	}
+	return parseCPUInfo(text)
 }
 
-// readRevision gets the hardware revision for a RPi
+// readModel gets the model from the device-tree, or from the cpuinfo Model line that newer kernels have if there is
+// no device-tree, or returns an empty string if neither has it
+func readModel(cpuinfo cpuInfo) string {
+	// the model is a device-tree property, and carries a NUL terminator that readFile does not remove
+	model, err := readDeviceTree(file(sys_model))
+	if err == nil {
+		return model
+	}
+	if model := cpuinfo.field("Model"); model != "" {
+		return model
+	}
+	warn("Unable to determine the model, %v can not be read (%v), and %v has no Model\n", file(sys_model), err, file(proc_cpuinfo))
+	return ""
+}
+
+// readRevision gets the hardware revision for a RPi, or an empty string if it has none, as in some virtualized
+// or non-Pi environments.
 func readRevision() string {
-	cpuinfo := readFilePanic(file(proc_cpuinfo))
-	revisionre := regexp.MustCompile(`(?sm).*^Revision\s+:\s+(\S+)\s*$.*`)
-	revision := revisionre.ReplaceAllString(cpuinfo, "$1")
-	return revision
+	return readCPUInfo().field("Revision")
 }
 
 var availableGPIO map[int]bool
 
-func setAvailableGPIOs() {
-	availableGPIO = make(map[int]bool)
+// ErrNoSysfsGPIO is returned for ports when the kernel has no sysfs GPIO interface (/sys/class/gpio), as is the
+// default on newer kernels where it is compiled out.
+var ErrNoSysfsGPIO = errors.New("The sysfs GPIO interface is not present, enable CONFIG_GPIO_SYSFS in the kernel or use the GPIO character device")
+
+// noSysfsGPIO is true if the sysfs GPIO interface is missing, rather than there being no GPIO chips
+var noSysfsGPIO bool
+
+// GPIOChip describes a GPIO controller, which provides the global GPIO numbers Base to Base+NGPIO-1
+type GPIOChip struct {
+	Label string
+	Base  int
+	NGPIO int
+	// Path is the chip's sysfs folder
+	Path string
+}
+
+// GPIOChips describes the GPIO controllers on the system, from sysfs. Chips that can not be read are skipped.
+func GPIOChips() ([]GPIOChip, error) {
 	gpio := file(sys_gpio)
-	nodes, err := ioutil.ReadDir(gpio)
+	nodes, err := filesystem.ReadDir(gpio)
 	if err != nil {
-		info("Unable to read folder %v: %v", gpio, err)
-		return
+		return nil, err
 	}
 	// See sysfs standard, needs to be a base and ngpio file: https://www.kernel.org/doc/Documentation/gpio/sysfs.txt
+	chips := []GPIOChip{}
 	for _, f := range nodes {
 		if strings.HasPrefix(f.Name(), "gpiochip") {
 			chip := filepath.Join(gpio, f.Name())
@@ -158,27 +295,58 @@ func setAvailableGPIOs() {
 			fngpio := filepath.Join(chip, "ngpio")
 			base, err := readStringFileAsInt(fbase)
 			if err != nil {
-				info("Unable to read file %v: %v", filepath.Join(chip, "base"), err)
+				warn("Unable to read file %v: %v", fbase, err)
 				continue
 			}
 			ngpio, err := readStringFileAsInt(fngpio)
 			if err != nil {
-				info("Unable to read file %v: %v", filepath.Join(chip, "ngpio"), err)
+				warn("Unable to read file %v: %v", fngpio, err)
 				continue
 			}
-			for i := 0; i < ngpio; i++ {
-				availableGPIO[base+i] = true
-			}
+			// the label is informative, and not essential
+			label, _ := readFile(filepath.Join(chip, "label"))
+			chips = append(chips, GPIOChip{Label: label, Base: base, NGPIO: ngpio, Path: chip})
+		}
+	}
+	return chips, nil
+}
+
+func setAvailableGPIOs() {
+	availableGPIO = make(map[int]bool)
+	chips, err := GPIOChips()
+	noSysfsGPIO = os.IsNotExist(err)
+	if noSysfsGPIO {
+		warn("%v (%v is missing)\n", ErrNoSysfsGPIO, file(sys_gpio))
+		return
+	}
+	if err != nil {
+		warn("Unable to read folder %v: %v", file(sys_gpio), err)
+		return
+	}
+	for _, chip := range chips {
+		for i := 0; i < chip.NGPIO; i++ {
+			availableGPIO[chip.Base+i] = true
 		}
 	}
 }
 
+// checkAvailable returns an error if the port is not provided by a GPIO chip on this system
+func checkAvailable(port int) error {
+	if availableGPIO[port] {
+		return nil
+	}
+	if noSysfsGPIO {
+		return ErrNoSysfsGPIO
+	}
+	return fmt.Errorf("Port %v is not available on this system", port)
+}
+
 func isChip(path string, name string) bool {
 	if !strings.HasPrefix(name, "gpiochip") {
 		return false
 	}
 	devname := filepath.Join(path, name, "device", "of_node", "name")
-	s, err := os.Stat(devname)
+	s, err := filesystem.Stat(devname)
 	if err != nil || s.IsDir() {
 		return false
 	}
@@ -193,29 +361,25 @@ func buildPi(revision, model string) *pi {
 
 	var pins []int
 	pinMap := findRevisionMap(revision)
-	def := "40V10"
-	if pinMap == "" {
-		log.Printf("Unable to locate an express mapping for revision '%v'. Using default %v'\n", revision, def)
+	def := "40v10"
+	if revision == "" {
+		warn("No hardware revision is known. Using default %v\n", def)
+		pinMap = def
+	} else if pinMap == "" {
+		warn("Unable to locate an express mapping for revision '%v'. Using default %v\n", revision, def)
 		pinMap = def
 	}
-	switch pinMap {
-	case "26v10":
-		pins = GPIO26HeaderV1
-	case "26v20":
-		pins = GPIO26HeaderV2
-	case "40v10":
-		pins = GPIO40HeaderV1
-	}
-
-	sort.Ints(pins)
+	pins = HeaderType(pinMap).GPIOPorts()
 
 	return &pi{
-		mu:        sync.Mutex{},
-		model:     model,
-		revision:  revision,
-		gpiodir:   file(sys_gpio),
-		gpioports: pins,
-		portctrl:  make(map[int]*gport),
+		mu:         sync.Mutex{},
+		model:      model,
+		revision:   revision,
+		gpiodir:    file(sys_gpio),
+		header:     pinMap,
+		gpioports:  pins,
+		portctrl:   make(map[int]*gport),
+		configured: make(map[int]InputSpec),
 	}
 }
 
@@ -229,11 +393,119 @@ func (p *pi) Model() string {
 	return p.model
 }
 
+// ModelType returns the board model, derived from the revision code, which is more reliable than the format of
+// the Model name for deciding what the board can do. It is ModelUnknown if the revision is not recognized.
+func (p *pi) ModelType() ModelType {
+	rc, ok := parseRevision(p.revision)
+	if !ok {
+		return ModelUnknown
+	}
+	return rc.modelType()
+}
+
 // Revision returns the given board revision
 func (p *pi) Revision() string {
 	return p.revision
 }
 
+// Serial returns the board's serial number, or an empty string if it is not known (as for details built with GetDetailsFor)
+func (p *pi) Serial() string {
+
+	defer p.unlock(p.lock())
+
+	return p.serial
+}
+
+// MemoryMB returns the memory size of the board in MB, derived from the revision, or 0 if it is not known
+func (p *pi) MemoryMB() int {
+	rc, ok := parseRevision(p.revision)
+	if !ok {
+		return 0
+	}
+	return rc.memoryMB()
+}
+
+// NumCores returns the number of processor cores on the board, or 0 if it is not known (as for details built with GetDetailsFor)
+func (p *pi) NumCores() int {
+
+	defer p.unlock(p.lock())
+
+	return p.cores
+}
+
+// CPUInfo returns the value of the named /proc/cpuinfo field, like "Hardware" or "model name", or an empty string
+// if there is no such field (and always for details built with GetDetailsFor). Fields that are listed for each
+// processor have the first processor's value. The cpuinfo is read once, and again by RefreshDetails.
+func (p *pi) CPUInfo(field string) string {
+
+	defer p.unlock(p.lock())
+
+	return p.cpuinfo.field(field)
+}
+
+// RefreshDetails reads the cpuinfo again, and updates the details derived from it, like the serial number and the
+// number of cores. The revision and model are not changed, as the ports are built for them. Details built with
+// GetDetailsFor are given, not read, and can not be refreshed.
+func (p *pi) RefreshDetails() error {
+	if !p.detected {
+		return fmt.Errorf("The details of revision %v were given, and can not be refreshed", p.revision)
+	}
+	cpuinfo := readCPUInfo()
+
+	defer p.unlock(p.lock())
+
+	p.setCPUInfo(cpuinfo)
+	return nil
+}
+
+// setCPUInfo sets the details derived from the cpuinfo, and needs to be called with the pi locked, or before it is shared
+func (p *pi) setCPUInfo(cpuinfo cpuInfo) {
+	p.cpuinfo = cpuinfo
+	p.serial = cpuinfo.field("Serial")
+	p.cores = cpuinfo.processors
+}
+
+// Capabilities returns the on-board peripherals of the board, derived from the revision, or none if it is not recognized.
+// They describe the board model, not whether the kernel has the peripherals enabled.
+func (p *pi) Capabilities() Capabilities {
+	rc, ok := parseRevision(p.revision)
+	if !ok {
+		return Capabilities{}
+	}
+	return rc.capabilities()
+}
+
+// Info returns a serializable description of the Pi
+func (p *pi) Info() PiInfo {
+	return PiInfo{
+		Model:     p.model,
+		Revision:  p.revision,
+		Serial:    p.Serial(),
+		MemoryMB:  p.MemoryMB(),
+		NumCores:  p.NumCores(),
+		Processor: p.ProcessorName(),
+		P1Ports:   p.P1GPIOPorts(),
+	}
+}
+
+// ProcessorName returns the name of the SoC on the board, derived from the revision, e.g. BCM2837.
+// It returns "unknown" if the revision is not recognized.
+func (p *pi) ProcessorName() string {
+	rc, ok := parseRevision(p.revision)
+	if !ok {
+		return "unknown"
+	}
+	return rc.processorName()
+}
+
+// Compatible returns the device-tree compatible list for the board, most specific first, for example
+// "raspberrypi,4-model-b" followed by "brcm,bcm2711". It is empty for details built with GetDetailsFor.
+func (p *pi) Compatible() []string {
+	cp := make([]string, len(p.compatible))
+	copy(cp, p.compatible)
+	return cp
+}
+
 // P1GPIOPorts returns the possible set of P1 header GPIOPorts based on the pi board/revision.
 // Note that some possible ports may be configured as a service other than GPIO (Uart, etc.)
 func (p *pi) P1GPIOPorts() []int {
@@ -242,11 +514,8 @@ func (p *pi) P1GPIOPorts() []int {
 	return cp
 }
 
-// IsPiPort returns true if the specified port could be a GPIO Port on the pi P1 header
+// IsP1Port returns true if the specified port is one of the GPIO Ports on the P1 header of this board
 func (p *pi) IsP1Port(port int) bool {
-	if port < 0 || port >= len(p.gpioports) {
-		return false
-	}
 	for _, pt := range p.gpioports {
 		if pt == port {
 			return true
@@ -259,8 +528,8 @@ func (p *pi) IsP1Port(port int) bool {
 // The control needs to be checked to ensure that the port is actually a GPIO Port
 // as some ports may be multiplexed in to UARTs, I2C, etc. or the port may not exist.
 func (p *pi) GetPort(port int) (GPIOPort, error) {
-	if !availableGPIO[port] {
-		return nil, fmt.Errorf("Port %v is not available on this system", port)
+	if err := checkAvailable(port); err != nil {
+		return nil, err
 	}
 	defer p.unlock(p.lock())
 	pctrl, ok := p.portctrl[port]
@@ -272,6 +541,150 @@ func (p *pi) GetPort(port int) (GPIOPort, error) {
 	return pctrl, nil
 }
 
+// GetHeaderPort returns a control point in to a GPIO Port like GetPort, but only if the port
+// is broken out on the P1 header of this board, rather than an internal line.
+func (p *pi) GetHeaderPort(port int) (GPIOPort, error) {
+	if !p.IsP1Port(port) {
+		return nil, fmt.Errorf("Port %v is not on the P1 header of revision %v, header ports are %v", port, p.revision, p.gpioports)
+	}
+	return p.GetPort(port)
+}
+
+// ReclaimPort adopts a port that is already exported, for example by this process before it restarted, so that its
+// direction and value are kept. Unlike Enable, which uses an exported port as it is, the port's state is read back
+// and checked, and the control replaces any from GetPort, with nothing cached or remembered from earlier SetMode
+// calls, and the monitors and SetValues of the replaced control are stopped. The port is not unexported and exported
+// again, which would glitch an output. It is an error if the port is not exported.
+func (p *pi) ReclaimPort(port int) (GPIOPort, error) {
+	if err := checkAvailable(port); err != nil {
+		return nil, err
+	}
+	gp := newGPIO(p, port)
+	state, err := gp.Snapshot()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to reclaim GPIO %v: %v", port, err)
+	}
+	if !state.Enabled {
+		return nil, fmt.Errorf("GPIO %v is not exported, and can not be reclaimed", port)
+	}
+
+	defer p.unlock(p.lock())
+	if old, ok := p.portctrl[port]; ok {
+		old.release()
+	}
+	p.portctrl[port] = gp
+	info("GPIO Reclaimed %v %v with value %v (edge %v, active low %v)\n", gp, state.Direction, state.Value, state.Edge, state.ActiveLow)
+	return gp, nil
+}
+
+// OpenOutput gets, enables, and configures a port as an output with the initial value, ready to use.
+// The direction and value are set in a single write ("high" or "low" to the direction file), so there is no glitch
+// where the pin drives the wrong level before the value is written. That only applies to this initial configuration,
+// later changes are separate writes. If a step fails after the port was enabled here, the port is reset again.
+func (p *pi) OpenOutput(port int, initial bool) (GPIOPort, error) {
+	mode := GPIOOutputLow
+	if initial {
+		mode = GPIOOutputHigh
+	}
+	return p.open(port, func(gp *gport) error {
+		return gp.SetMode(mode)
+	})
+}
+
+// OpenInput gets, enables, and configures a port as an input that signals the edge, ready to use.
+// If a step fails after the port was enabled here, the port is reset again.
+func (p *pi) OpenInput(port int, edge GPIOEdge) (GPIOPort, error) {
+	return p.open(port, func(gp *gport) error {
+		if err := gp.SetMode(GPIOInput); err != nil {
+			return err
+		}
+		return gp.setEdge(edge)
+	})
+}
+
+// open gets and enables the port, and then configures it, resetting it on failure if it was not already enabled
+func (p *pi) open(port int, configure func(*gport) error) (GPIOPort, error) {
+	ctrl, err := p.GetPort(port)
+	if err != nil {
+		return nil, err
+	}
+	gp := ctrl.(*gport)
+	enabled := gp.IsEnabled()
+	if err := gp.Enable(); err != nil {
+		return nil, err
+	}
+	if err := configure(gp); err != nil {
+		if !enabled {
+			if rerr := gp.Reset(); rerr != nil {
+				warn("Unable to reset GPIO %v after failing to open it: %v\n", port, rerr)
+			}
+		}
+		return nil, err
+	}
+	return gp, nil
+}
+
+// ResetAllOnSignal installs a handler that, on the first of the signals (os.Interrupt and SIGTERM if none are given),
+// resets every port that has been got from this Pi and is enabled (except those set to be kept, see
+// GPIOPort.SetKeepExported), and then raises the signal again for its
+// default action, which usually terminates the process. Call the returned function to remove the handler.
+func (p *pi) ResetAllOnSignal(sigs ...os.Signal) func() {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	killer := make(chan bool)
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(killer)
+		})
+	}
+
+	done := startBackground(cancel)
+	go func() {
+		defer done()
+		select {
+		case <-killer:
+			return
+		case sig := <-ch:
+			warn("Resetting all GPIO ports on signal %v\n", sig)
+			p.resetAll()
+			signal.Reset(sig)
+			cancel()
+			if proc, err := os.FindProcess(os.Getpid()); err == nil {
+				proc.Signal(sig)
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// resetAll resets every port that has been got from this Pi and is enabled, unless it is kept
+func (p *pi) resetAll() {
+	p.lock()
+	ports := make([]*gport, 0, len(p.portctrl))
+	for _, port := range p.portctrl {
+		ports = append(ports, port)
+	}
+	p.unlock(true)
+
+	for _, port := range ports {
+		if port.isKept() {
+			info("GPIO %v kept exported\n", port)
+			continue
+		}
+		if err := port.Reset(); err != nil {
+			errorf("Unable to reset GPIO %v: %v\n", port.port, err)
+		}
+	}
+}
+
 func (p *pi) portFolder(port int) string {
 	return file("sys", "class", "gpio", fmt.Sprintf("gpio%d", port))
 }
@@ -0,0 +1,339 @@
+package gopisysfs
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestInfoJSON(t *testing.T) {
+	data, err := json.Marshal(GetPi().Info())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var info PiInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Serial != "0000000002db1491" || info.Revision != testrevision || info.Processor != "BCM2837" || info.MemoryMB != 1024 {
+		t.Errorf("Unexpected details from %s", data)
+	}
+}
+
+func TestGetHeaderPort(t *testing.T) {
+	pi := GetDetailsFor(testrevision, testmodel)
+	if _, err := pi.GetHeaderPort(testoutport); err != nil {
+		t.Error(err)
+	}
+	// GPIO 45 is available, but not broken out on the header
+	if _, err := pi.GetPort(45); err != nil {
+		t.Error(err)
+	}
+	if _, err := pi.GetHeaderPort(45); err == nil {
+		t.Errorf("Expected an error getting internal port 45 as a header port")
+	}
+}
+
+func TestCountCores(t *testing.T) {
+	for _, tc := range []struct {
+		cpuinfo string
+		cores   int
+	}{
+		{"processor\t: 0\nmodel name\t: ARMv7 Processor rev 4 (v7l)\n\nprocessor\t: 1\n\nprocessor\t: 2\n\nprocessor\t: 3\nHardware\t: BCM2835\n", 4},
+		{"Processor\t: ARMv6-compatible processor rev 7 (v6l)\nBogoMIPS\t: 697.95\nHardware\t: BCM2708\n", 0},
+		{"Processor\t: ARMv6-compatible processor rev 7 (v6l)\nprocessor\t: 0\nBogoMIPS\t: 697.95\n", 1},
+		{"processor:0\r\nprocessor :  1  \r\n", 2},
+		{"", 0},
+	} {
+		if cores := parseCPUInfo(tc.cpuinfo).processors; cores != tc.cores {
+			t.Errorf("Expected %v cores but got %v from %q", tc.cores, cores, tc.cpuinfo)
+		}
+	}
+	if cores := GetPi().NumCores(); cores != 4 {
+		t.Errorf("Expected the test Pi to have 4 cores, but got %v", cores)
+	}
+}
+
+func TestOpenPorts(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	out, err := pi.OpenOutput(testoutport, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Reset()
+	if state, err := out.Snapshot(); err != nil || state.Direction != GPIOOutput || !state.Value {
+		t.Errorf("Expected an output with value true but got %+v (%v)", state, err)
+	}
+
+	in, err := pi.OpenInput(testinport, GPIOEdgeRising)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Reset()
+	if state, err := in.Snapshot(); err != nil || state.Direction != GPIOInput || state.Edge != GPIOEdgeRising {
+		t.Errorf("Expected an input on the rising edge but got %+v (%v)", state, err)
+	}
+
+	// a failure to configure resets the port that was enabled
+	if _, err := pi.OpenInput(testinport+1, GPIOEdge(42)); err == nil {
+		t.Errorf("Expected an error opening an input with an invalid edge")
+	}
+	if port, _ := pi.GetPort(testinport + 1); port.IsEnabled() {
+		t.Errorf("Expected port %v to be reset after failing to open", testinport+1)
+	}
+}
+
+// writeLog records the writes to the file system it wraps
+type writeLog struct {
+	FileSystem
+	writes []string
+}
+
+func (w *writeLog) WriteFile(name string, data []byte) error {
+	w.writes = append(w.writes, filepath.Base(name)+"="+string(data))
+	return w.FileSystem.WriteFile(name, data)
+}
+
+func TestOpenOutputGlitchFree(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	log := &writeLog{FileSystem: fs}
+	SetFileSystem(log)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	out, err := pi.OpenOutput(testoutport, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Reset()
+	for _, write := range log.writes {
+		if strings.HasPrefix(write, "value=") || write == "direction=out" {
+			t.Errorf("Expected the output to be configured in a single direction write, but got %v", log.writes)
+		}
+	}
+}
+
+func TestParseCPURevision(t *testing.T) {
+	for _, tc := range []struct {
+		cpuinfo  string
+		revision string
+	}{
+		{"processor\t: 0\nHardware\t: BCM2835\nRevision\t: a22082\nSerial\t\t: 0000000002db1491\n", "a22082"},
+		{"processor\t: 0\nvendor_id\t: GenuineIntel\nmodel name\t: Virtual CPU\n", ""},
+		{"", ""},
+	} {
+		if revision := parseCPUInfo(tc.cpuinfo).field("Revision"); revision != tc.revision {
+			t.Errorf("Expected revision %q but got %q from %q", tc.revision, revision, tc.cpuinfo)
+		}
+	}
+	if revision := GetDetailsFor(parseCPUInfo("processor\t: 0\n").field("Revision"), testmodel).Revision(); revision != "" {
+		t.Errorf("Expected no revision but got %q", revision)
+	}
+}
+
+func TestResetAll(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	board := GetDetailsFor(testrevision, testmodel)
+	out, err := board.OpenOutput(testoutport, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := board.OpenInput(testinport, GPIOEdgeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := board.OpenOutput(testinport+1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept.SetKeepExported(true)
+	// a port that was got but never enabled
+	if _, err := board.GetPort(testinport + 2); err != nil {
+		t.Fatal(err)
+	}
+
+	board.(*pi).resetAll()
+	if out.IsEnabled() || in.IsEnabled() {
+		t.Errorf("Expected all ports to be reset")
+	}
+	if !kept.IsEnabled() {
+		t.Errorf("Expected the kept port to remain exported")
+	}
+
+	// the handler can be removed before any signal
+	cancel := board.ResetAllOnSignal()
+	cancel()
+	cancel()
+}
+
+func TestGPIOChips(t *testing.T) {
+	chips, err := GPIOChips()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chips) != 1 {
+		t.Fatalf("Expected one chip but got %+v", chips)
+	}
+	expect := GPIOChip{Label: "pinctrl-bcm2835", Base: 0, NGPIO: 54, Path: file(sys_gpio, "gpiochip0")}
+	if chips[0] != expect {
+		t.Errorf("Expected chip %+v but got %+v", expect, chips[0])
+	}
+}
+
+func TestIsP1Port(t *testing.T) {
+	var board Pi = GetDetailsFor(testrevision, testmodel)
+	for _, port := range board.P1GPIOPorts() {
+		if !board.IsP1Port(port) {
+			t.Errorf("Expected header port %v to be a P1 port", port)
+		}
+	}
+	for _, port := range []int{-1, 0, 1, 28, 45, 54} {
+		if board.IsP1Port(port) {
+			t.Errorf("Expected port %v to not be a P1 port", port)
+		}
+	}
+}
+
+func TestNoSysfsGPIO(t *testing.T) {
+	SetLogFn(t.Logf)
+	SetFileSystem(NewMemFS())
+	defer SetFileSystem(nil)
+
+	board := GetDetailsFor(testrevision, testmodel)
+	if _, err := board.GetPort(testoutport); err != ErrNoSysfsGPIO {
+		t.Errorf("Expected ErrNoSysfsGPIO without /sys/class/gpio but got %v", err)
+	}
+
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	if _, err := board.GetPort(100); err == nil || err == ErrNoSysfsGPIO {
+		t.Errorf("Expected a port that is not available but got %v", err)
+	}
+}
+
+func TestPortHost(t *testing.T) {
+	board := GetDetailsFor(testrevision, testmodel)
+	port, err := board.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if port.Host() != board {
+		t.Errorf("Expected the port's host to be the Pi it came from")
+	}
+}
+
+func TestGetPiNotOnPi(t *testing.T) {
+	SetLogFn(t.Logf)
+	// neither the device-tree model nor the cpuinfo exist
+	SetFileSystem(NewMemFS())
+	saved := host
+	getdetails = sync.Once{}
+	defer func() {
+		SetFileSystem(nil)
+		host = saved
+		if saved == nil {
+			getdetails = sync.Once{}
+		}
+	}()
+
+	board := GetPi()
+	if board.Model() != "" || board.Revision() != "" {
+		t.Errorf("Expected an empty model and revision but got %q and %q", board.Model(), board.Revision())
+	}
+
+	fs := NewMemFS()
+	fs.AddFile(proc_cpuinfo, []byte("processor\t: 0\nRevision\t: a22082\nModel\t\t: Raspberry Pi 3 Model B Rev 1.2\n"))
+	SetFileSystem(fs)
+	getdetails = sync.Once{}
+	if model := GetPi().Model(); model != "Raspberry Pi 3 Model B Rev 1.2" {
+		t.Errorf("Expected the model from the cpuinfo but got %q", model)
+	}
+}
+
+func TestReclaimPort(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	before := GetDetailsFor(testrevision, testmodel)
+	if _, err := before.ReclaimPort(testoutport); err == nil {
+		t.Errorf("Expected an error reclaiming a port that is not exported")
+	}
+	if _, err := before.OpenOutput(testoutport, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// a restarted process adopts the output, without exporting it again
+	log := &writeLog{FileSystem: fs}
+	SetFileSystem(log)
+	after := GetDetailsFor(testrevision, testmodel)
+	port, err := after.ReclaimPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+	if len(log.writes) != 0 {
+		t.Errorf("Expected nothing to be written reclaiming a port, but got %v", log.writes)
+	}
+	state, err := port.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := (PortState{Enabled: true, Direction: GPIOOutput, Value: true, Edge: GPIOEdgeNone}); state != expect {
+		t.Errorf("Expected state %+v but got %+v", expect, state)
+	}
+	if again, err := after.GetPort(testoutport); err != nil || again != port {
+		t.Errorf("Expected GetPort to return the reclaimed port, but got %v: %v", again, err)
+	}
+}
+
+func TestRefreshDetails(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddFile(proc_cpuinfo, []byte("processor\t: 0\nmodel name\t: ARMv7 Processor rev 4 (v7l)\nRevision\t: a22082\nSerial\t\t: 0000000002db1491\n"))
+	SetFileSystem(fs)
+	saved := host
+	getdetails = sync.Once{}
+	defer func() {
+		SetFileSystem(nil)
+		host = saved
+		if saved == nil {
+			getdetails = sync.Once{}
+		}
+	}()
+
+	board := GetPi()
+	if board.Serial() != "0000000002db1491" || board.NumCores() != 1 || board.CPUInfo("model name") != "ARMv7 Processor rev 4 (v7l)" {
+		t.Errorf("Expected the details from the cpuinfo but got %+v", board.Info())
+	}
+
+	fs.AddFile(proc_cpuinfo, []byte("processor\t: 0\nprocessor\t: 1\nRevision\t: a22082\nSerial\t\t: 00000000abcdef12\n"))
+	if err := board.RefreshDetails(); err != nil {
+		t.Fatal(err)
+	}
+	if board.Serial() != "00000000abcdef12" || board.NumCores() != 2 || board.CPUInfo("model name") != "" {
+		t.Errorf("Expected the refreshed details from the cpuinfo but got %+v", board.Info())
+	}
+
+	if err := GetDetailsFor(testrevision, testmodel).RefreshDetails(); err == nil {
+		t.Errorf("Expected an error refreshing the details of GetDetailsFor")
+	}
+}
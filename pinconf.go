@@ -0,0 +1,82 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	sys_pinctrl = "sys/kernel/debug/pinctrl"
+	// pinconfState is the pinctrl map state that the pin configuration is modified in
+	pinconfState = "default"
+)
+
+// findPinconf locates the pinconf-config file of the pinctrl device that controls the port, and returns the
+// file and device name, or an error if the kernel does not provide a way to configure the pin.
+func findPinconf(port int) (string, string, error) {
+	root := file(sys_pinctrl)
+	nodes, err := filesystem.ReadDir(root)
+	if err != nil {
+		return "", "", fmt.Errorf("GPIO %v pin configuration is unsupported on this kernel/board: %v", port, err)
+	}
+	// the pins file lists a line like "pin 17 (gpio17) ..." for each pin the device controls
+	pinname := fmt.Sprintf("(gpio%d)", port)
+	for _, node := range nodes {
+		if !node.IsDir() {
+			continue
+		}
+		dir := filepath.Join(root, node.Name())
+		config := filepath.Join(dir, "pinconf-config")
+		if !checkFile(config) {
+			continue
+		}
+		pins, err := readFile(filepath.Join(dir, "pins"))
+		if err != nil || !strings.Contains(pins, pinname) {
+			continue
+		}
+		return config, node.Name(), nil
+	}
+	return "", "", fmt.Errorf("GPIO %v pin configuration is unsupported on this kernel/board: no pinctrl device in %v can modify it", port, root)
+}
+
+// writePinconf modifies a generic pin configuration parameter of the port
+func writePinconf(port int, param string, arg int) error {
+	config, device, err := findPinconf(port)
+	if err != nil {
+		return err
+	}
+	// see pinconf_dbg_config_write: modify config_pin <devicename> <state> <pinname> <newvalue>
+	request := fmt.Sprintf("modify config_pin %v %v gpio%d %v:%d", device, pinconfState, port, param, arg)
+	debug("GPIO %v pin configuration %v\n", port, request)
+	if err := writeFile(config, request); err != nil {
+		return fmt.Errorf("GPIO %v pin configuration %v:%d was rejected: %v", port, param, arg, err)
+	}
+	return nil
+}
+
+// SetDrive sets the drive strength of the port's pad, in mA from 2 to 16 in steps of 2. The kernel has to expose
+// pin configuration (through the pinctrl debugfs), which is detected at runtime, and an error describes it as
+// unsupported otherwise. Many kernels only configure the drive of a whole bank of pins from the device-tree.
+func (p *pi) SetDrive(port int, mA int) error {
+	if mA < 2 || mA > 16 || mA%2 != 0 {
+		return fmt.Errorf("GPIO %v drive strength %vmA needs to be 2 to 16mA, in steps of 2", port, mA)
+	}
+	if err := checkAvailable(port); err != nil {
+		return err
+	}
+	return writePinconf(port, "drive-strength", mA)
+}
+
+// SetSlew limits the slew rate of the port's pad if limited is true, or allows fast edges otherwise. Slower edges
+// reduce ringing and interference on longer wires. Support is detected at runtime, like for SetDrive.
+func (p *pi) SetSlew(port int, limited bool) error {
+	if err := checkAvailable(port); err != nil {
+		return err
+	}
+	arg := 0
+	if limited {
+		arg = 1
+	}
+	return writePinconf(port, "slew-rate", arg)
+}
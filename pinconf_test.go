@@ -0,0 +1,44 @@
+package gopisysfs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPinconf(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	if err := pi.SetDrive(testoutport, 8); err == nil {
+		t.Errorf("Expected pin configuration to be unsupported without a pinctrl device")
+	} else {
+		t.Logf("Unsupported: %v", err)
+	}
+
+	dev := file(sys_pinctrl, "3f200000.gpio")
+	fs.AddFile(filepath.Join(dev, "pins"), []byte("pin 22 (gpio22) 3f200000.gpio\npin 23 (gpio23) 3f200000.gpio\n"))
+	fs.AddFile(filepath.Join(dev, "pinconf-config"), nil)
+
+	if err := pi.SetDrive(testoutport, 8); err != nil {
+		t.Fatal(err)
+	}
+	if config, _ := readFile(filepath.Join(dev, "pinconf-config")); config != "modify config_pin 3f200000.gpio default gpio23 drive-strength:8" {
+		t.Errorf("Unexpected pin configuration %v", config)
+	}
+	if err := pi.SetSlew(testoutport, true); err != nil {
+		t.Fatal(err)
+	}
+	if config, _ := readFile(filepath.Join(dev, "pinconf-config")); config != "modify config_pin 3f200000.gpio default gpio23 slew-rate:1" {
+		t.Errorf("Unexpected pin configuration %v", config)
+	}
+
+	if err := pi.SetDrive(testinport, 8); err == nil {
+		t.Errorf("Expected pin configuration to be unsupported for a pin the device does not control")
+	}
+	if err := pi.SetDrive(testoutport, 3); err == nil {
+		t.Errorf("Expected an error for an odd drive strength")
+	}
+}
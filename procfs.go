@@ -0,0 +1,54 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// host metrics, from https://www.kernel.org/doc/Documentation/filesystems/proc.txt
+const (
+	proc_uptime  = "proc/uptime"
+	proc_loadavg = "proc/loadavg"
+)
+
+// Uptime is a host metric, reporting how long the system has been running.
+func Uptime() (time.Duration, error) {
+	name := file(proc_uptime)
+	data, err := readFile(name)
+	if err != nil {
+		return 0, err
+	}
+	// the uptime is followed by the idle time, both in seconds
+	fields := strings.Fields(data)
+	if len(fields) < 1 {
+		return 0, fmt.Errorf("Unable to find the uptime in %v: %v", name, data)
+	}
+	secs, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("Unable to convert uptime %v from %v: %v", fields[0], name, err)
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// LoadAverage is a host metric, reporting the average number of runnable processes over the last 1, 5, and 15 minutes.
+func LoadAverage() ([3]float64, error) {
+	var load [3]float64
+	name := file(proc_loadavg)
+	data, err := readFile(name)
+	if err != nil {
+		return load, err
+	}
+	// the averages are followed by the running/total processes, and the last PID
+	fields := strings.Fields(data)
+	if len(fields) < len(load) {
+		return load, fmt.Errorf("Unable to find the load averages in %v: %v", name, data)
+	}
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return load, fmt.Errorf("Unable to convert load average %v from %v: %v", fields[i], name, err)
+		}
+	}
+	return load, nil
+}
@@ -0,0 +1,26 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUptime(t *testing.T) {
+	uptime, err := Uptime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := 350735470 * time.Millisecond; uptime != expect {
+		t.Errorf("Expected uptime %v but got %v", expect, uptime)
+	}
+}
+
+func TestLoadAverage(t *testing.T) {
+	load, err := LoadAverage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := [3]float64{0.12, 0.34, 1.56}; load != expect {
+		t.Errorf("Expected load %v but got %v", expect, load)
+	}
+}
@@ -0,0 +1,37 @@
+package gopisysfs
+
+import (
+	"sync"
+)
+
+// Provider supplies GPIO ports. Pi is the sysfs implementation, and alternatives, for example for USB GPIO adapters
+// on other hosts, or fakes in tests, can be installed with SetProvider. Code that gets its ports from GetProvider
+// runs unchanged on either.
+type Provider interface {
+	// P1GPIOPorts lists the GPIO ports the provider can supply
+	P1GPIOPorts() []int
+	// GetPort returns the controller for the GPIO port
+	GetPort(int) (GPIOPort, error)
+}
+
+var (
+	providermu sync.Mutex
+	provider   Provider
+)
+
+// SetProvider replaces the Provider returned by GetProvider, or restores the Pi being run on if p is nil.
+func SetProvider(p Provider) {
+	providermu.Lock()
+	defer providermu.Unlock()
+	provider = p
+}
+
+// GetProvider returns the Provider set by SetProvider, or the Pi being run on (see GetPi) if none is set.
+func GetProvider() Provider {
+	providermu.Lock()
+	defer providermu.Unlock()
+	if provider == nil {
+		return GetPi()
+	}
+	return provider
+}
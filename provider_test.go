@@ -0,0 +1,50 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fakeProvider supplies ports from a map, like a non-sysfs implementation would
+type fakeProvider map[int]GPIOPort
+
+func (f fakeProvider) P1GPIOPorts() []int {
+	ports := []int{}
+	for port := range f {
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+func (f fakeProvider) GetPort(port int) (GPIOPort, error) {
+	if gp, ok := f[port]; ok {
+		return gp, nil
+	}
+	return nil, fmt.Errorf("Port %v is not available from the fake provider", port)
+}
+
+func TestProvider(t *testing.T) {
+	if _, ok := GetProvider().(Pi); !ok {
+		t.Errorf("Expected the default provider to be the Pi")
+	}
+
+	port, err := GetDetailsFor(testrevision, testmodel).GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := fakeProvider{testoutport: port}
+	SetProvider(fake)
+	defer SetProvider(nil)
+
+	if got, err := GetProvider().GetPort(testoutport); err != nil || got != port {
+		t.Errorf("Expected port %v from the fake provider but got %v (%v)", port, got, err)
+	}
+	if _, err := GetProvider().GetPort(testinport); err == nil {
+		t.Errorf("Expected an error getting a port the provider does not have")
+	}
+
+	SetProvider(nil)
+	if GetProvider() != GetPi() {
+		t.Errorf("Expected the Pi to be restored as the provider")
+	}
+}
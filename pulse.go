@@ -0,0 +1,101 @@
+package gopisysfs
+
+import (
+	"time"
+)
+
+// Pulse is the measurement of one cycle of a pulsed input: the time it was high, followed by the time it was low.
+type Pulse struct {
+	// Start is the time of the rising edge that started the cycle
+	Start        time.Time
+	HighDuration time.Duration
+	LowDuration  time.Duration
+}
+
+// Period returns the duration of the whole cycle
+func (p Pulse) Period() time.Duration {
+	return p.HighDuration + p.LowDuration
+}
+
+// Frequency returns the number of cycles per second, or 0 for an empty cycle
+func (p Pulse) Frequency() float64 {
+	if p.Period() <= 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(p.Period())
+}
+
+// Duty returns the fraction (0.0 to 1.0) of the cycle that the input was high, or 0 for an empty cycle
+func (p Pulse) Duty() float64 {
+	if p.Period() <= 0 {
+		return 0
+	}
+	return float64(p.HighDuration) / float64(p.Period())
+}
+
+// PulseCapture monitors an enabled input port, and measures each cycle of its pulses from the edge timestamps.
+// A Pulse is sent on the returned channel at each rising edge that completes a cycle. The channel has the given
+// buffer depth (0 for DefaultWatchBuffer), and pulses are dropped if the consumer falls behind. The channel is
+// closed when the returned stop function is called, or when the port is reset.
+// The timestamps are taken when the monitor reads the value after the kernel reports an edge, so the resolution is
+// limited by the latency of poll and sysfs reads. That is adequate from tens of hz to the low khz, but higher
+// frequencies lose edges, and cycles with a lost edge are discarded rather than measured.
+func PulseCapture(port GPIOPort, buffer int) (<-chan Pulse, func(), error) {
+	if buffer == 0 {
+		buffer = DefaultWatchBuffer
+	}
+	events, stop, err := port.Watch(WatchConfig{Edge: GPIOEdgeBoth, Buffer: buffer})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pulses := make(chan Pulse, buffer)
+	done := startBackground(stop)
+	go func() {
+		defer done()
+		capturePulses(events, pulses)
+	}()
+
+	return pulses, stop, nil
+}
+
+// capturePulses measures the cycles in the events until the events are closed, and then closes the pulses
+func capturePulses(events <-chan Event, pulses chan<- Pulse) {
+
+	defer close(pulses)
+
+	// the first event is the value when the monitor started, not an edge
+	var last *Event
+	// the edges of the cycle in progress, zero if not seen
+	var rise, fall time.Time
+
+	for event := range events {
+		event := event
+		if last == nil || event.Value == last.Value {
+			// the initial value, or an edge was lost, start a new cycle
+			rise, fall = time.Time{}, time.Time{}
+			last = &event
+			continue
+		}
+		last = &event
+
+		if !event.Value {
+			fall = event.Timestamp
+			continue
+		}
+
+		if !rise.IsZero() && !fall.IsZero() {
+			pulse := Pulse{
+				Start:        rise,
+				HighDuration: fall.Sub(rise),
+				LowDuration:  event.Timestamp.Sub(fall),
+			}
+			select {
+			case pulses <- pulse:
+			default:
+				warn("Pulse capture dropped pulse %v: receive channel overflow\n", pulse)
+			}
+		}
+		rise, fall = event.Timestamp, time.Time{}
+	}
+}
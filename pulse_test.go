@@ -0,0 +1,55 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCapturePulses(t *testing.T) {
+	start := time.Now()
+	at := func(ms int, value bool) Event {
+		return Event{Value: value, Timestamp: start.Add(time.Duration(ms) * time.Millisecond)}
+	}
+
+	events := make(chan Event, 10)
+	pulses := make(chan Pulse, 10)
+	for _, e := range []Event{
+		at(0, false), // initial value
+		at(5, true),
+		at(8, false),
+		at(15, true), // completes 3ms high, 7ms low
+		at(17, false),
+		at(18, false), // lost a rising edge, discard the cycle
+		at(20, true),
+		at(21, false),
+		at(30, true), // completes 1ms high, 9ms low
+	} {
+		events <- e
+	}
+	close(events)
+
+	capturePulses(events, pulses)
+
+	var got []Pulse
+	for p := range pulses {
+		got = append(got, p)
+	}
+	expect := []Pulse{
+		{Start: start.Add(5 * time.Millisecond), HighDuration: 3 * time.Millisecond, LowDuration: 7 * time.Millisecond},
+		{Start: start.Add(20 * time.Millisecond), HighDuration: 1 * time.Millisecond, LowDuration: 9 * time.Millisecond},
+	}
+	if len(got) != len(expect) {
+		t.Fatalf("Expected %v pulses but got %v", expect, got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("Expected pulse %v to be %v but got %v", i, expect[i], got[i])
+		}
+	}
+	if f := got[0].Frequency(); f != 100 {
+		t.Errorf("Expected frequency 100 but got %v", f)
+	}
+	if d := got[1].Duty(); d != 0.1 {
+		t.Errorf("Expected duty 0.1 but got %v", d)
+	}
+}
@@ -0,0 +1,194 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// from https://www.raspberrypi.org/documentation/hardware/raspberrypi/revision-codes/README.md
+
+// revisionCode is a hardware revision decoded in to its fields.
+// New-style revision codes are a bitfield: NOQuuuWuFMMMCCCCPPPPTTTTTTTTRRRR
+// Old-style revision codes are a simple sequence, and only the code is known.
+type revisionCode struct {
+	code         uint64
+	newstyle     bool
+	revision     int
+	boardtype    int
+	processor    int
+	manufacturer int
+	memory       int
+}
+
+// old-style codes that this package knows about range from 0002 to 0015
+const (
+	oldRevisionFirst = 0x0002
+	oldRevisionLast  = 0x0015
+)
+
+// processorNames is indexed by the processor field of a new-style revision code
+var processorNames = []string{"BCM2835", "BCM2836", "BCM2837", "BCM2711", "BCM2712"}
+
+// oldRevisionMemory gives the memory size in MB for the old-style revision codes
+var oldRevisionMemory = map[uint64]int{
+	0x0002: 256, 0x0003: 256, 0x0004: 256, 0x0005: 256, 0x0006: 256, 0x0007: 256,
+	0x0008: 256, 0x0009: 256, 0x000d: 512, 0x000e: 512, 0x000f: 512, 0x0010: 512,
+	0x0011: 512, 0x0012: 256, 0x0013: 512, 0x0014: 512, 0x0015: 256,
+}
+
+// Capabilities describes the on-board peripherals of a board model, as derived from its revision code
+type Capabilities struct {
+	HasWiFi      bool
+	HasBluetooth bool
+	// HasEthernet is true for boards with an Ethernet port (which is on the USB bus before the Pi 4)
+	HasEthernet bool
+	// HasPoEHeader is true for boards with the 4-pin header for a PoE HAT
+	HasPoEHeader bool
+}
+
+var (
+	wireless = Capabilities{HasWiFi: true, HasBluetooth: true}
+	ethernet = Capabilities{HasEthernet: true}
+	wiredB   = Capabilities{HasWiFi: true, HasBluetooth: true, HasEthernet: true}
+	poeB     = Capabilities{HasWiFi: true, HasBluetooth: true, HasEthernet: true, HasPoEHeader: true}
+)
+
+// boardCapabilities is indexed by the board type field of a new-style revision code. Wireless is optional on the
+// Compute Modules, and the revision code does not say whether it is fitted, so they are listed without it.
+var boardCapabilities = map[int]Capabilities{
+	0x01: ethernet, // B
+	0x03: ethernet, // B+
+	0x04: ethernet, // 2B
+	0x08: wiredB,   // 3B
+	0x0c: wireless, // Zero W
+	0x0d: poeB,     // 3B+
+	0x0e: wireless, // 3A+
+	0x11: poeB,     // 4B
+	0x12: wireless, // Zero 2 W
+	0x13: wiredB,   // 400
+	0x17: poeB,     // 5
+	0x19: wiredB,   // 500
+}
+
+// oldRevisionEthernet lists the old-style revision codes of the model B boards, the others are model A and CM1
+var oldRevisionEthernet = map[uint64]bool{
+	0x0002: true, 0x0003: true, 0x0004: true, 0x0005: true, 0x0006: true,
+	0x000d: true, 0x000e: true, 0x000f: true, 0x0010: true, 0x0013: true,
+}
+
+// ModelType identifies the board model, as derived from the revision code
+type ModelType int
+
+const (
+	// ModelUnknown is a board with a revision code that is not recognized
+	ModelUnknown ModelType = iota
+	Pi1A
+	Pi1B
+	Pi1APlus
+	Pi1BPlus
+	PiCM1
+	Pi2B
+	Pi3B
+	Pi3BPlus
+	Pi3APlus
+	PiCM3
+	PiCM3Plus
+	PiZero
+	PiZeroW
+	PiZero2W
+	Pi4B
+	Pi400
+	PiCM4
+	PiCM4S
+	Pi5
+	Pi500
+	PiCM5
+)
+
+var modelTypeNames = map[ModelType]string{
+	ModelUnknown: "unknown", Pi1A: "A", Pi1B: "B", Pi1APlus: "A+", Pi1BPlus: "B+", PiCM1: "CM1", Pi2B: "2B",
+	Pi3B: "3B", Pi3BPlus: "3B+", Pi3APlus: "3A+", PiCM3: "CM3", PiCM3Plus: "CM3+", PiZero: "Zero", PiZeroW: "Zero W",
+	PiZero2W: "Zero 2 W", Pi4B: "4B", Pi400: "400", PiCM4: "CM4", PiCM4S: "CM4S", Pi5: "5", Pi500: "500", PiCM5: "CM5",
+}
+
+// String returns the short name of the model, as used in the revision code documentation, e.g. 3B+
+func (m ModelType) String() string {
+	if name, ok := modelTypeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("ModelType(%d)", int(m))
+}
+
+// boardModels is indexed by the board type field of a new-style revision code. The Alpha and internal boards are
+// not listed, and are unknown.
+var boardModels = map[int]ModelType{
+	0x00: Pi1A, 0x01: Pi1B, 0x02: Pi1APlus, 0x03: Pi1BPlus, 0x04: Pi2B, 0x06: PiCM1, 0x08: Pi3B, 0x09: PiZero,
+	0x0a: PiCM3, 0x0c: PiZeroW, 0x0d: Pi3BPlus, 0x0e: Pi3APlus, 0x10: PiCM3Plus, 0x11: Pi4B, 0x12: PiZero2W,
+	0x13: Pi400, 0x14: PiCM4, 0x15: PiCM4S, 0x17: Pi5, 0x18: PiCM5, 0x19: Pi500, 0x1a: PiCM5,
+}
+
+// oldRevisionModels gives the board model of the old-style revision codes
+var oldRevisionModels = map[uint64]ModelType{
+	0x0002: Pi1B, 0x0003: Pi1B, 0x0004: Pi1B, 0x0005: Pi1B, 0x0006: Pi1B, 0x0007: Pi1A, 0x0008: Pi1A,
+	0x0009: Pi1A, 0x000d: Pi1B, 0x000e: Pi1B, 0x000f: Pi1B, 0x0010: Pi1BPlus, 0x0011: PiCM1, 0x0012: Pi1APlus,
+	0x0013: Pi1BPlus, 0x0014: PiCM1, 0x0015: Pi1APlus,
+}
+
+// parseRevision decodes the hex revision code, returning false if it is not a valid code.
+func parseRevision(revision string) (revisionCode, bool) {
+	code, err := strconv.ParseUint(strings.TrimSpace(revision), 16, 32)
+	if err != nil {
+		return revisionCode{}, false
+	}
+	rc := revisionCode{code: code}
+	if code&(1<<23) == 0 {
+		// old-style, but strip the warranty-void flags that can be set on any code (e.g. 1000002)
+		rc.code = code & 0xffffff
+		return rc, rc.code >= oldRevisionFirst && rc.code <= oldRevisionLast
+	}
+	rc.newstyle = true
+	rc.revision = int(code & 0xf)
+	rc.boardtype = int((code >> 4) & 0xff)
+	rc.processor = int((code >> 12) & 0xf)
+	rc.manufacturer = int((code >> 16) & 0xf)
+	rc.memory = int((code >> 20) & 0x7)
+	return rc, true
+}
+
+// processorName returns the SoC name for the revision, or unknown
+func (rc revisionCode) processorName() string {
+	if !rc.newstyle {
+		// all old-style revisions are the original BCM2835 boards
+		return "BCM2835"
+	}
+	if rc.processor < len(processorNames) {
+		return processorNames[rc.processor]
+	}
+	return "unknown"
+}
+
+// memoryMB returns the memory size in MB for the revision, or 0 if unknown
+func (rc revisionCode) memoryMB() int {
+	if !rc.newstyle {
+		return oldRevisionMemory[rc.code]
+	}
+	return 256 << uint(rc.memory)
+}
+
+// capabilities returns the on-board peripherals of the revision's board model
+func (rc revisionCode) capabilities() Capabilities {
+	if !rc.newstyle {
+		// the original boards have no wireless, and no PoE header
+		return Capabilities{HasEthernet: oldRevisionEthernet[rc.code]}
+	}
+	return boardCapabilities[rc.boardtype]
+}
+
+// modelType returns the board model of the revision
+func (rc revisionCode) modelType() ModelType {
+	if !rc.newstyle {
+		return oldRevisionModels[rc.code]
+	}
+	return boardModels[rc.boardtype]
+}
@@ -0,0 +1,99 @@
+package gopisysfs
+
+import (
+	"testing"
+)
+
+func TestProcessorName(t *testing.T) {
+	for _, tc := range []struct {
+		revision  string
+		processor string
+	}{
+		{"0002", "BCM2835"},
+		{"1000002", "BCM2835"},
+		{"900092", "BCM2835"},
+		{"a01041", "BCM2836"},
+		{"a22082", "BCM2837"},
+		{"c03111", "BCM2711"},
+		{"d04170", "BCM2712"},
+		{"Beta", "unknown"},
+		{"0099", "unknown"},
+		{"", "unknown"},
+	} {
+		got := GetDetailsFor(tc.revision, testmodel).ProcessorName()
+		if got != tc.processor {
+			t.Errorf("Expected revision %q to have processor %v but got %v", tc.revision, tc.processor, got)
+		}
+	}
+}
+
+func TestMemoryMB(t *testing.T) {
+	for _, tc := range []struct {
+		revision string
+		memory   int
+	}{
+		{"0002", 256},
+		{"000e", 512},
+		{"900092", 512},
+		{"a22082", 1024},
+		{"c03111", 4096},
+		{"Beta", 0},
+	} {
+		got := GetDetailsFor(tc.revision, testmodel).MemoryMB()
+		if got != tc.memory {
+			t.Errorf("Expected revision %q to have %vMB but got %vMB", tc.revision, tc.memory, got)
+		}
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		revision string
+		expect   Capabilities
+	}{
+		{"0002", Capabilities{HasEthernet: true}},
+		{"0012", Capabilities{}},
+		{"900092", Capabilities{}},
+		{"9000c1", Capabilities{HasWiFi: true, HasBluetooth: true}},
+		{"a22082", Capabilities{HasWiFi: true, HasBluetooth: true, HasEthernet: true}},
+		{"a020d3", Capabilities{HasWiFi: true, HasBluetooth: true, HasEthernet: true, HasPoEHeader: true}},
+		{"c03111", Capabilities{HasWiFi: true, HasBluetooth: true, HasEthernet: true, HasPoEHeader: true}},
+		{"b03141", Capabilities{}},
+		{"Beta", Capabilities{}},
+	} {
+		got := GetDetailsFor(tc.revision, testmodel).Capabilities()
+		if got != tc.expect {
+			t.Errorf("Expected revision %q to have %+v but got %+v", tc.revision, tc.expect, got)
+		}
+	}
+}
+
+func TestModelType(t *testing.T) {
+	for _, tc := range []struct {
+		revision string
+		model    ModelType
+	}{
+		{"0002", Pi1B},
+		{"1000002", Pi1B},
+		{"0012", Pi1APlus},
+		{"900092", PiZero},
+		{"9000c1", PiZeroW},
+		{"a01041", Pi2B},
+		{"a22082", Pi3B},
+		{"a020d3", Pi3BPlus},
+		{"c03111", Pi4B},
+		{"c03130", Pi400},
+		{"a03140", PiCM4},
+		{"d04170", Pi5},
+		{"Beta", ModelUnknown},
+		{"0099", ModelUnknown},
+	} {
+		got := GetDetailsFor(tc.revision, testmodel).ModelType()
+		if got != tc.model {
+			t.Errorf("Expected revision %q to be model %v but got %v", tc.revision, tc.model, got)
+		}
+	}
+	if Pi3BPlus.String() != "3B+" {
+		t.Errorf("Expected the name 3B+ but got %v", Pi3BPlus)
+	}
+}
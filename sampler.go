@@ -0,0 +1,79 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SampleReader is an io.Reader that samples the values of a set of ports at a fixed interval, and packs each
+// sample in to bytes: the value of ports[i] is bit i%8 of byte i/8, so 8 ports make a byte per sample.
+// Each Read blocks until the next tick, and then returns one sample. If the reader falls behind, ticks are
+// skipped rather than queued, so the samples stay evenly spaced but some are lost. Each port is read through sysfs
+// in turn, which takes tens of microseconds per port, so a sample is not a snapshot of all ports at one instant,
+// and intervals much below a millisecond can't be kept up.
+type SampleReader struct {
+	ports  []GPIOPort
+	ticker *time.Ticker
+	size   int
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewSampleReader creates a SampleReader on the ports, which should already be enabled, sampling them every interval.
+// Close the reader to stop sampling.
+func NewSampleReader(ports []GPIOPort, interval time.Duration) (*SampleReader, error) {
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("Sampling needs at least one port")
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("Sample interval %v needs to be positive", interval)
+	}
+	return &SampleReader{
+		ports:  ports,
+		ticker: time.NewTicker(interval),
+		size:   (len(ports) + 7) / 8,
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// SampleSize returns the number of bytes in each sample
+func (r *SampleReader) SampleSize() int {
+	return r.size
+}
+
+// Read waits for the next tick and reads a sample in to the buffer, which has to have room for a whole sample.
+// It returns io.EOF once the reader is closed, including a Read that is waiting when Close is called.
+func (r *SampleReader) Read(buffer []byte) (int, error) {
+	if len(buffer) < r.size {
+		return 0, io.ErrShortBuffer
+	}
+	select {
+	case <-r.done:
+		return 0, io.EOF
+	case <-r.ticker.C:
+	}
+	for i := 0; i < r.size; i++ {
+		buffer[i] = 0
+	}
+	for i, port := range r.ports {
+		val, err := port.Value()
+		if err != nil {
+			return 0, err
+		}
+		if val {
+			buffer[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return r.size, nil
+}
+
+// Close stops sampling, and ends the reads, which return io.EOF. It is safe to call more than once.
+func (r *SampleReader) Close() error {
+	r.once.Do(func() {
+		r.ticker.Stop()
+		close(r.done)
+	})
+	return nil
+}
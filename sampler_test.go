@@ -0,0 +1,89 @@
+package gopisysfs
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSampleReader(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	ports := []GPIOPort{}
+	// 9 ports, alternating high and low, make 2 bytes per sample
+	for i, pin := range []int{4, 5, 6, 12, 13, 16, 17, 18, 19} {
+		port, err := pi.OpenOutput(pin, i%2 == 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer port.Reset()
+		ports = append(ports, port)
+	}
+
+	reader, err := NewSampleReader(ports, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.Read(make([]byte, 1)); err != io.ErrShortBuffer {
+		t.Errorf("Expected a short buffer error but got %v", err)
+	}
+	buffer := make([]byte, 10)
+	n, err := reader.Read(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || buffer[0] != 0x55 || buffer[1] != 0x01 {
+		t.Errorf("Expected sample 55 01 but got % x", buffer[:n])
+	}
+}
+
+func TestSampleReaderClose(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	port, err := pi.OpenOutput(testoutport, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	// the first tick is an hour away, so the read blocks until the reader is closed
+	reader, err := NewSampleReader([]GPIOPort{port}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		_, err := reader.Read(make([]byte, 1))
+		result <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		if err != io.EOF {
+			t.Errorf("Expected the blocked read to return EOF but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the blocked read to return when the reader was closed")
+	}
+	if _, err := reader.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Expected a read after close to return EOF but got %v", err)
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("Expected a second close to succeed but got %v", err)
+	}
+}
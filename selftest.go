@@ -0,0 +1,52 @@
+package gopisysfs
+
+import (
+	"fmt"
+)
+
+// SelfTest checks that the port works end to end through sysfs: it exports the port, drives it high and then low,
+// reading the value back each time, and unexports it again. The pin is driven, so only test pins that are safe to
+// drive. A port that is already exported, or that is claimed by a driver (where IsPinClaimed can tell), is refused.
+func (p *pi) SelfTest(port int) error {
+	ctrl, err := p.GetPort(port)
+	if err != nil {
+		return err
+	}
+	if ctrl.IsEnabled() {
+		return fmt.Errorf("GPIO %v self test refused, the port is already exported", port)
+	}
+	if claimed, owner, err := IsPinClaimed(port); err == nil && claimed {
+		return fmt.Errorf("GPIO %v self test refused, the pin is owned by %v", port, owner)
+	}
+
+	info("GPIO %v self test starting\n", port)
+	if err := ctrl.Enable(); err != nil {
+		return fmt.Errorf("GPIO %v self test failed to export: %v", port, err)
+	}
+	err = selfTestLevels(ctrl)
+	if rerr := ctrl.Reset(); rerr != nil && err == nil {
+		err = fmt.Errorf("GPIO %v self test failed to unexport: %v", port, rerr)
+	}
+	if err != nil {
+		return err
+	}
+	info("GPIO %v self test passed\n", port)
+	return nil
+}
+
+// selfTestLevels drives the enabled port high and then low, checking the value read back after each
+func selfTestLevels(ctrl GPIOPort) error {
+	for _, mode := range []GPIOMode{GPIOOutputHigh, GPIOOutputLow} {
+		if err := ctrl.SetMode(mode); err != nil {
+			return fmt.Errorf("%v self test failed to set mode %v: %v", ctrl, mode, err)
+		}
+		val, err := ctrl.Value()
+		if err != nil {
+			return fmt.Errorf("%v self test failed to read back mode %v: %v", ctrl, mode, err)
+		}
+		if val != (mode == GPIOOutputHigh) {
+			return fmt.Errorf("%v self test read back %v in mode %v", ctrl, val, mode)
+		}
+	}
+	return nil
+}
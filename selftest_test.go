@@ -0,0 +1,37 @@
+package gopisysfs
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	board := GetDetailsFor(testrevision, testmodel)
+	if err := board.SelfTest(testoutport); err != nil {
+		t.Fatal(err)
+	}
+	port, _ := board.GetPort(testoutport)
+	if port.IsEnabled() {
+		t.Errorf("Expected the port to be unexported after the self test")
+	}
+
+	if err := port.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := board.SelfTest(testoutport); err == nil {
+		t.Errorf("Expected the self test to refuse an exported port")
+	}
+	port.Reset()
+
+	fs.AddFile(filepath.Join(sys_pinctrl, "3f200000.gpio", "pinmux-pins"),
+		[]byte("pin 14 (gpio14): 3f201000.serial (GPIO UNCLAIMED) function alt0 group gpio14\n"))
+	if err := board.SelfTest(14); err == nil {
+		t.Errorf("Expected the self test to refuse a pin owned by a driver")
+	}
+}
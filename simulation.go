@@ -0,0 +1,54 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	simulatedModel    = "Simulated Raspberry Pi"
+	simulatedRevision = "a22082"
+)
+
+// simulatedFS is a MemFS modelling a Pi, that logs the writes made to it
+type simulatedFS struct {
+	*MemFS
+}
+
+func newSimulatedFS() simulatedFS {
+	fs := NewMemFS()
+	fs.AddFile(sys_model, []byte(simulatedModel+"\x00"))
+	fs.AddFile(sys_compat, []byte("raspberrypi,3-model-b\x00brcm,bcm2837\x00"))
+	fs.AddFile(proc_cpuinfo, []byte(fmt.Sprintf("processor\t: 0\nHardware\t: BCM2835\nRevision\t: %v\nSerial\t\t: 0000000000000000\n", simulatedRevision)))
+	fs.AddGPIOChip(0, 54)
+	return simulatedFS{fs}
+}
+
+func (s simulatedFS) WriteFile(name string, data []byte) error {
+	if err := s.MemFS.WriteFile(name, data); err != nil {
+		return err
+	}
+	info("Simulated write of %v to %v\n", strings.TrimSpace(string(data)), name)
+	return nil
+}
+
+// SetSimulation replaces sysfs and procfs with an in-memory model of a Pi, or restores the real files.
+// While simulating, ports can be enabled, configured, and set, and the writes are logged instead of made to sysfs.
+// Output values read back as they were last written, and inputs read as low. Ports can be watched, and their monitors
+// poll the simulated values. IsOnPi reports false.
+// Call it before GetPi, as the details of the Pi are only read once. See SetFileSystem for the limitations,
+// and MemFS for a model that can be inspected and changed by test cases.
+func SetSimulation(simulate bool) {
+	if !simulate {
+		SetFileSystem(nil)
+		return
+	}
+	SetFileSystem(newSimulatedFS())
+	info("Simulating %v revision %v\n", simulatedModel, simulatedRevision)
+}
+
+// isSimulating returns true if SetSimulation has replaced the real files
+func isSimulating() bool {
+	_, ok := filesystem.(simulatedFS)
+	return ok
+}
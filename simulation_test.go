@@ -0,0 +1,90 @@
+package gopisysfs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSimulation(t *testing.T) {
+	SetLogFn(t.Logf)
+	SetSimulation(true)
+	defer SetSimulation(false)
+
+	if IsOnPi() {
+		t.Errorf("Expected IsOnPi to be false while simulating")
+	}
+	if revision := readRevision(); revision != simulatedRevision {
+		t.Errorf("Expected simulated revision %v but got %v", simulatedRevision, revision)
+	}
+
+	pi := GetDetailsFor(simulatedRevision, simulatedModel)
+	port, err := pi.GetPort(testoutport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := port.Enable(); err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+	if err := port.SetMode(GPIOOutput); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []bool{true, false} {
+		if err := port.SetValue(v); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := port.Value(); err != nil || got != v {
+			t.Errorf("Expected simulated value %v but got %v (%v)", v, got, err)
+		}
+	}
+}
+
+func TestSimulationWatch(t *testing.T) {
+	SetLogFn(t.Logf)
+	SetSimulation(true)
+	defer SetSimulation(false)
+
+	pi := GetDetailsFor(simulatedRevision, simulatedModel)
+	port, err := pi.OpenOutput(testoutport, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer port.Reset()
+
+	events, stop, err := port.Watch(WatchConfig{Edge: GPIOEdgeRising})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	select {
+	case event := <-events:
+		if !event.Baseline || event.Value {
+			t.Errorf("Expected a low baseline but got %v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the baseline of the simulated port")
+	}
+
+	for _, v := range []bool{true, false, true} {
+		if err := port.SetValue(v); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * EdgelessPollInterval)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case event := <-events:
+			if !event.Value {
+				t.Errorf("Expected a rising edge but got %v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected rising edge %v of the simulated port", i+1)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Errorf("Expected only the rising edges but got %v", event)
+	case <-time.After(5 * EdgelessPollInterval):
+	}
+}
@@ -0,0 +1,111 @@
+package gopisysfs
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSuperviseBackoff is the wait before re-establishing a supervised watch when none is specified
+	DefaultSuperviseBackoff = 100 * time.Millisecond
+	// maxSuperviseBackoff limits the doubling of the wait between failed attempts to re-establish a watch
+	maxSuperviseBackoff = 30 * time.Second
+)
+
+// WatchRestart reports an attempt by a supervised watch to re-establish a monitor that stopped unexpectedly
+type WatchRestart struct {
+	Timestamp time.Time
+	// Attempt counts the attempts since the monitor stopped, starting at 1
+	Attempt int
+	// Err is nil if the monitor was re-established, otherwise the reason this attempt failed
+	Err error
+}
+
+// SupervisedWatch monitors the port like GPIOPort.Watch, but if the monitor stops unexpectedly, for example on a
+// transient poll error, it is re-established on the same channel. The first attempt waits for the backoff
+// (0 for DefaultSuperviseBackoff), and the wait doubles after each failed attempt. Every attempt is reported on the
+// status channel, which is dropped if the status is not received. Supervision ends, and both channels are closed,
+// when the returned stop function is called, or when the port is reset. Events are not buffered beyond cfg.Buffer.
+func SupervisedWatch(port GPIOPort, cfg WatchConfig, backoff time.Duration) (<-chan Event, <-chan WatchRestart, func(), error) {
+	events, stopwatch, err := port.Watch(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if backoff <= 0 {
+		backoff = DefaultSuperviseBackoff
+	}
+
+	data := make(chan Event)
+	status := make(chan WatchRestart, DefaultWatchBuffer)
+	killer := make(chan bool)
+	var once sync.Once
+	killfn := func() {
+		once.Do(func() { close(killer) })
+	}
+
+	report := func(restart WatchRestart) {
+		select {
+		case status <- restart:
+		default:
+			warn("GPIO Supervisor %v dropped status %+v: receive channel overflow\n", port, restart)
+		}
+	}
+
+	done := startBackground(killfn)
+	go func() {
+		defer done()
+		defer close(status)
+		defer close(data)
+
+		for {
+			// relay the events until the monitor stops
+			for open := true; open; {
+				select {
+				case <-killer:
+					stopwatch()
+					return
+				case event, ok := <-events:
+					if !ok {
+						open = false
+						continue
+					}
+					select {
+					case data <- event:
+					case <-killer:
+						stopwatch()
+						return
+					}
+				}
+			}
+
+			warn("GPIO Supervisor %v monitor stopped unexpectedly\n", port)
+			wait := backoff
+			for attempt := 1; ; attempt++ {
+				select {
+				case <-killer:
+					return
+				case <-time.After(wait):
+				}
+				if !port.IsEnabled() {
+					info("GPIO Supervisor %v ending, the port is reset\n", port)
+					return
+				}
+				events, stopwatch, err = port.Watch(cfg)
+				report(WatchRestart{Timestamp: time.Now(), Attempt: attempt, Err: err})
+				if err == nil {
+					if gp, ok := port.(*gport); ok {
+						gp.metrics.restart()
+					}
+					info("GPIO Supervisor %v monitor restarted after %v attempts\n", port, attempt)
+					break
+				}
+				warn("GPIO Supervisor %v restart attempt %v failed: %v\n", port, attempt, err)
+				if wait *= 2; wait > maxSuperviseBackoff {
+					wait = maxSuperviseBackoff
+				}
+			}
+		}
+	}()
+
+	return data, status, killfn, nil
+}
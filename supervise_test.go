@@ -0,0 +1,85 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// watchPort is a GPIOPort that hands out a new test channel each time it is watched
+type watchPort struct {
+	GPIOPort
+	watches chan chan Event
+	fail    int
+	enabled bool
+}
+
+func (p *watchPort) Watch(cfg WatchConfig) (<-chan Event, func(), error) {
+	if p.fail > 0 {
+		p.fail--
+		return nil, nil, fmt.Errorf("Simulated watch failure")
+	}
+	ch := make(chan Event, 1)
+	p.watches <- ch
+	return ch, func() {}, nil
+}
+
+func (p *watchPort) IsEnabled() bool {
+	return p.enabled
+}
+
+func (p *watchPort) String() string {
+	return "test port"
+}
+
+func TestSupervisedWatch(t *testing.T) {
+	SetLogFn(t.Logf)
+	port := &watchPort{watches: make(chan chan Event, 3), enabled: true}
+	events, status, stop, err := SupervisedWatch(port, WatchConfig{}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := <-port.watches
+	first <- Event{Value: true}
+	if e := <-events; !e.Value {
+		t.Errorf("Expected the relayed event to be true")
+	}
+
+	// the monitor dies, and the first restart fails
+	port.fail = 1
+	close(first)
+	if r := <-status; r.Attempt != 1 || r.Err == nil {
+		t.Errorf("Expected a failed first attempt but got %+v", r)
+	}
+	if r := <-status; r.Attempt != 2 || r.Err != nil {
+		t.Errorf("Expected a successful second attempt but got %+v", r)
+	}
+	second := <-port.watches
+	second <- Event{Value: false, Previous: true}
+	if e := <-events; !e.Previous {
+		t.Errorf("Expected the relayed event to have a previous value of true")
+	}
+
+	stop()
+	for range events {
+	}
+	for range status {
+	}
+
+	// a reset port ends the supervision
+	port.enabled = false
+	events, _, _, err = SupervisedWatch(port, WatchConfig{}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(<-port.watches)
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Errorf("Expected no events after the monitor stopped")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Expected supervision to end when the port is reset")
+	}
+}
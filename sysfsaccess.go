@@ -1,6 +1,7 @@
 package gopisysfs
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -20,6 +21,54 @@ const (
 
 var rootpath = "/"
 
+// FileSystem is the access this library needs to the sysfs and procfs files. The default uses the real files,
+// but an alternative, like a MemFS, can be set with SetFileSystem(...) to exercise code that uses this library without a Pi.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte) error
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+// osFileSystem is the default FileSystem, using the real files
+type osFileSystem struct{}
+
+func (osFileSystem) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (osFileSystem) WriteFile(name string, data []byte) error {
+	return ioutil.WriteFile(name, data, 0444)
+}
+
+func (osFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (osFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+var filesystem FileSystem = osFileSystem{}
+
+// SetFileSystem replaces the file system used to access sysfs and procfs, or restores the real one if fs is nil.
+// Set it before using any other part of the library, as the available GPIO ports are rescanned from it.
+// Port monitoring (Values, Watch) can not wait for interrupts with an alternative file system, so it polls the value
+// every EdgelessPollInterval instead.
+func SetFileSystem(fs FileSystem) {
+	if fs == nil {
+		fs = osFileSystem{}
+	}
+	filesystem = fs
+	setAvailableGPIOs()
+}
+
+// isOSFileSystem returns true if the real files are being used
+func isOSFileSystem() bool {
+	_, ok := filesystem.(osFileSystem)
+	return ok
+}
+
 // setRoot is designed to be called by the test cases to exercise some hard-to-change things on an actual pi.
 func setRoot(rt string) {
 	rootpath = rt
@@ -35,6 +84,36 @@ func file(paths ...string) string {
 	return path
 }
 
+// ReadSysAttr reads a sysfs (or procfs) attribute that this library does not model, and returns its content trimmed
+// of white space. The relpath is relative to the file system root, like "sys/class/thermal/thermal_zone0/temp".
+// This is a low-level escape hatch: prefer the modelled functions where they exist.
+func ReadSysAttr(relpath string) (string, error) {
+	name, err := sysAttr(relpath)
+	if err != nil {
+		return "", err
+	}
+	return readFile(name)
+}
+
+// WriteSysAttr overwrites a sysfs attribute that this library does not model, see ReadSysAttr.
+// This is a low-level escape hatch, and writing the wrong attribute can change the behaviour of the system.
+func WriteSysAttr(relpath, val string) error {
+	name, err := sysAttr(relpath)
+	if err != nil {
+		return err
+	}
+	return writeFile(name, val)
+}
+
+// sysAttr resolves an attribute's relative path, rejecting paths that are absolute or that escape the root
+func sysAttr(relpath string) (string, error) {
+	clean := filepath.Clean(relpath)
+	if relpath == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("Attribute path %v needs to be relative to the root, like sys/class/...", relpath)
+	}
+	return file(clean), nil
+}
+
 // readFilePanic reads a file returning the contents as a string, and panics if it cannot be read
 func readFilePanic(name string) string {
 	data, err := readFile(name)
@@ -48,90 +127,80 @@ func readFilePanic(name string) string {
 // at which point the returned channel will return a nil on the channel. A non-nil indicates
 // an error in the polling.
 func awaitFileCreate(name string, timeout time.Duration) (<-chan error, error) {
+	return awaitFileCreateCtx(context.Background(), name, timeout)
+}
 
-	ret := make(chan error, 1)
-
-	if checkFile(name) {
-		ret <- nil
-		return ret, nil
-	}
+// awaitFileCreateCtx is awaitFileCreate, but the poll is also abandoned when the context is done,
+// in which case the context's error is returned on the channel.
+func awaitFileCreateCtx(ctx context.Context, name string, timeout time.Duration) (<-chan error, error) {
 
 	dir := filepath.Dir(name)
-	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
-		if err != nil {
-			return nil, fmt.Errorf("Unable to poll for a file in a nonexistent folder %v: %v", dir, err)
-		}
-		return nil, fmt.Errorf("Unable to poll for a file in a non-folder %v: %v", dir, stat)
-	}
-
-	// set up notification and timeout
-	tout := time.After(timeout)
-	// intervals at every poll cycle
-	interval := time.NewTicker(pollInterval).C
-	// naieve polling system
-	go func() {
-		for {
-
-			if checkFile(name) {
-				// Found it!
-				ret <- nil
-				return
-			}
-
-			select {
-			case <-tout:
-				ret <- fmt.Errorf("Timed out waiting for %v after %v", name, timeout)
-				return
-			case <-interval:
-				// ignore specific event, check actual file later
+	if !checkFile(name) {
+		if stat, err := filesystem.Stat(dir); err != nil || !stat.IsDir() {
+			if err != nil {
+				return nil, fmt.Errorf("Unable to poll for a file in a nonexistent folder %v: %v", dir, err)
 			}
+			return nil, fmt.Errorf("Unable to poll for a file in a non-folder %v: %v", dir, stat)
 		}
-	}()
-
-	return ret, nil
+	}
 
+	return awaitFile(ctx, name, true, timeout), nil
 }
 
 // awaitFileRemove establishes an asynchronous poll on a file location until it is removed
 // at which point the returned channel will return a nil on the channel. A non-nil indicates
 // an error in the polling.
 func awaitFileRemove(name string, timeout time.Duration) (<-chan error, error) {
+	return awaitFileRemoveCtx(context.Background(), name, timeout)
+}
+
+// awaitFileRemoveCtx is awaitFileRemove, but the poll is also abandoned when the context is done,
+// in which case the context's error is returned on the channel.
+func awaitFileRemoveCtx(ctx context.Context, name string, timeout time.Duration) (<-chan error, error) {
+	return awaitFile(ctx, name, false, timeout), nil
+}
+
+// awaitFile polls until the file's existence is the same as exists, the timeout passes, or the context is done
+func awaitFile(ctx context.Context, name string, exists bool, timeout time.Duration) <-chan error {
 
 	ret := make(chan error, 1)
 
-	// file is not there. Easy.
-	if !checkFile(name) {
+	// already there (or not there). Easy.
+	if checkFile(name) == exists {
 		ret <- nil
-		return ret, nil
+		return ret
 	}
 
-	// set up notification and timeout
-	tout := time.After(timeout)
-	// intervals at every 20 milliseconds
-	interval := time.NewTicker(pollInterval).C
-
 	// naieve polling system
 	go func() {
+		// set up notification and timeout
+		tout := time.NewTimer(timeout)
+		defer tout.Stop()
+		// intervals at every poll cycle
+		interval := time.NewTicker(pollInterval)
+		defer interval.Stop()
+
 		for {
 
-			if !checkFile(name) {
-				// gone!
+			if checkFile(name) == exists {
 				ret <- nil
 				return
 			}
 
 			select {
-			case <-tout:
+			case <-tout.C:
 				ret <- fmt.Errorf("Timed out waiting for %v after %v", name, timeout)
 				return
-			case <-interval:
+			case <-ctx.Done():
+				ret <- ctx.Err()
+				return
+			case <-interval.C:
 				// ignore specific event, check actual file later
 			}
 		}
 	}()
 
-	return ret, nil
-
+	return ret
 }
 
 func readStringFileAsInt(name string) (int, error) {
@@ -148,7 +217,7 @@ func readStringFileAsInt(name string) (int, error) {
 
 //readFile reads the file and returns the contents as a string (trimmed)
 func readFile(name string) (string, error) {
-	data, err := ioutil.ReadFile(name)
+	data, err := readBytes(name)
 	if err != nil {
 		return "", err
 	}
@@ -159,25 +228,51 @@ func readFile(name string) (string, error) {
 
 // readBuffer reads a file in to a byte buffer
 func readBytes(name string) ([]byte, error) {
-	return ioutil.ReadFile(name)
+	data, err := filesystem.ReadFile(name)
+	trace("read", name, data, err)
+	return data, err
 }
 
 // writeBuffer writes a buffer in to a file
 func writeBuffer(name string, data []byte) error {
 	//info("Writing to %v: %v\n", name, data)
-	return ioutil.WriteFile(name, data, 0444)
+	err := filesystem.WriteFile(name, data)
+	trace("write", name, data, err)
+	return err
 }
 
 // writeFile will overwrite the specified file with the given string content
 func writeFile(name, text string) error {
 	//info("Writing to %v: %v\n", name, text)
+	return writeBuffer(name, []byte(text))
+}
+
+// writeFileSync writes the text to a sysfs attribute in a single write, and syncs it before closing, for operations
+// that the following ones depend on (export and unexport). It does not truncate the file first, which some sysfs
+// attributes do not expect. An alternative FileSystem is written to as usual.
+func writeFileSync(name, text string) error {
+	if !isOSFileSystem() {
+		return writeFile(name, text)
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0444)
+	if err != nil {
+		return err
+	}
 	data := []byte(text)
-	return ioutil.WriteFile(name, data, 0444)
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	trace("write", name, data, err)
+	return err
 }
 
 // checkFile retuns true if the specified file exists
 func checkFile(name string) bool {
-	if _, err := os.Stat(name); err == nil {
+	if _, err := filesystem.Stat(name); err == nil {
 		// exists, but is it writable?
 		// already exists
 		return true
@@ -1,6 +1,7 @@
 package gopisysfs
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,6 +14,8 @@ var nowtime string
 func init() {
 	abs, _ := filepath.Abs("testdata")
 	setRoot(abs)
+	// the init() in pi.go scanned the real /sys, rescan the test tree instead.
+	setAvailableGPIOs()
 	nowtime = fmt.Sprintf("%v", time.Now().UnixNano())
 }
 
@@ -186,3 +189,80 @@ func TestAwaitRemoveStill(t *testing.T) {
 	}
 
 }
+
+func TestSysAttr(t *testing.T) {
+	name := fmt.Sprintf("tmp/gopitest.%v.%v.attr", os.Getpid(), nowtime)
+	if err := WriteSysAttr(name, "42\n"); err != nil {
+		t.Fatal(err)
+	}
+	val, err := ReadSysAttr(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "42" {
+		t.Errorf("Expected to read '42' but got '%v'", val)
+	}
+	for _, bad := range []string{"", "/sys/class/gpio/export", "../etc/passwd", "sys/../../etc/passwd"} {
+		if _, err := ReadSysAttr(bad); err == nil {
+			t.Errorf("Expected an error reading attribute %v", bad)
+		}
+	}
+}
+
+func TestAwaitFileCancel(t *testing.T) {
+	SetLogFn(t.Logf)
+	name := tmpFile("awaitcancel")
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := awaitFileCreateCtx(ctx, name, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case err := <-ch:
+		if err != context.Canceled {
+			t.Errorf("Expected context.Canceled but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the poll to be abandoned when the context was canceled")
+	}
+}
+
+func TestWriteFileSync(t *testing.T) {
+	name := tmpFile("writesync")
+	if err := writeFileSync(name, "12"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readFile(name); err != nil || data != "12" {
+		t.Errorf("Expected to read 12 but got %q (%v)", data, err)
+	}
+	// sysfs attributes take each write as a whole, regular files are not truncated first
+	if err := writeFileSync(name, "3"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readFile(name); err != nil || data != "32" {
+		t.Errorf("Expected the write to replace only the start, but read %q (%v)", data, err)
+	}
+}
+
+func TestTraceSysfs(t *testing.T) {
+	fs := NewMemFS()
+	fs.AddFile("sys/trace", []byte("1\n"))
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	var traced []string
+	TraceSysfs(func(op, path string, data []byte, err error) {
+		traced = append(traced, fmt.Sprintf("%v %v %q %v", op, filepath.Base(path), data, err != nil))
+	})
+	defer TraceSysfs(nil)
+
+	readFile(file("sys", "trace"))
+	writeFile(file("sys", "trace"), "0")
+	readFile(file("sys", "missing"))
+
+	expect := []string{`read trace "1\n" false`, `write trace "0" false`, `read missing "" true`}
+	if fmt.Sprint(traced) != fmt.Sprint(expect) {
+		t.Errorf("Expected the trace %q but got %q", expect, traced)
+	}
+}
@@ -0,0 +1,58 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sys_thermal = "sys/class/thermal"
+	thermalZone = "thermal_zone"
+)
+
+// Celsius is a temperature in degrees Celsius
+type Celsius float64
+
+// Fahrenheit converts the temperature to degrees Fahrenheit
+func (c Celsius) Fahrenheit() float64 {
+	return float64(c)*9/5 + 32
+}
+
+// ThermalZones lists the thermal zones on the system, like thermal_zone0, in zone number order.
+func ThermalZones() ([]string, error) {
+	nodes, err := filesystem.ReadDir(file(sys_thermal))
+	if err != nil {
+		return nil, err
+	}
+	zones := []int{}
+	for _, f := range nodes {
+		if !strings.HasPrefix(f.Name(), thermalZone) {
+			continue
+		}
+		if zone, err := strconv.Atoi(f.Name()[len(thermalZone):]); err == nil {
+			zones = append(zones, zone)
+		}
+	}
+	sort.Ints(zones)
+	names := make([]string, len(zones))
+	for i, zone := range zones {
+		names[i] = fmt.Sprintf("%v%d", thermalZone, zone)
+	}
+	return names, nil
+}
+
+// ZoneTemperature reads the temperature of the numbered thermal zone. The kernel reports it in millidegrees.
+func ZoneTemperature(zone int) (Celsius, error) {
+	milli, err := readStringFileAsInt(file(sys_thermal, fmt.Sprintf("%v%d", thermalZone, zone), "temp"))
+	if err != nil {
+		return 0, err
+	}
+	return Celsius(milli) / 1000, nil
+}
+
+// Temperature reads the temperature of thermal zone 0, which is the SoC on a Pi.
+func Temperature() (Celsius, error) {
+	return ZoneTemperature(0)
+}
@@ -0,0 +1,34 @@
+package gopisysfs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestThermalZones(t *testing.T) {
+	zones, err := ThermalZones()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"thermal_zone0", "thermal_zone1"}; !reflect.DeepEqual(zones, expect) {
+		t.Errorf("Expected zones %v but got %v", expect, zones)
+	}
+
+	temp, err := Temperature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != 48.312 {
+		t.Errorf("Expected 48.312C but got %v", temp)
+	}
+	temp, err = ZoneTemperature(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if temp != -5.5 || temp.Fahrenheit() != 22.1 {
+		t.Errorf("Expected -5.5C (22.1F) but got %v (%vF)", temp, temp.Fahrenheit())
+	}
+	if _, err := ZoneTemperature(2); err == nil {
+		t.Errorf("Expected an error reading a missing zone")
+	}
+}
@@ -0,0 +1,93 @@
+package gopisysfs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// WordOption configures optional behaviour of a WriteWord
+type WordOption func(*wordConfig)
+
+type wordConfig struct {
+	reverse bool
+}
+
+// WordReverse makes WriteWord write the pins from the last to the first, instead of from the first to the last.
+func WordReverse() WordOption {
+	return func(cfg *wordConfig) {
+		cfg.reverse = true
+	}
+}
+
+// WriteWord sets the first bits pins to the bits of the value, least significant bit first, so pins[0] gets bit 0.
+// All the pins have to be enabled outputs, and they are all locked before any is written, so the values are written
+// in a tight loop. Sysfs has no way to write more than one port at a time though, so the pins still change one after
+// the other, and a device watching the bus may see the intermediate values. Latch the word with a separate strobe
+// if that matters. If a write fails, the pins before it keep their new values.
+func (p *pi) WriteWord(pins []int, value uint, bits int, opts ...WordOption) error {
+
+	cfg := &wordConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	if bits < 1 || bits > len(pins) {
+		return fmt.Errorf("Word of %v bits needs between 1 and %v (the number of pins) bits", bits, len(pins))
+	}
+	if bits < 64 && value>>uint(bits) != 0 {
+		return fmt.Errorf("Word value 0x%x does not fit in %v bits", value, bits)
+	}
+	pins = pins[:bits]
+
+	ports := make([]*gport, len(pins))
+	for i, pin := range pins {
+		port, err := p.GetPort(pin)
+		if err != nil {
+			return err
+		}
+		ports[i] = port.(*gport)
+	}
+
+	// lock the ports in port order, so concurrent words on overlapping pins can't deadlock
+	locking := make([]*gport, len(ports))
+	copy(locking, ports)
+	sort.Slice(locking, func(i, j int) bool { return locking[i].port < locking[j].port })
+	for i := 1; i < len(locking); i++ {
+		if locking[i] == locking[i-1] {
+			return fmt.Errorf("Word pins %v include GPIO %v more than once", pins, locking[i].port)
+		}
+	}
+	for _, port := range locking {
+		defer port.unlock(port.lock())
+	}
+
+	for _, port := range ports {
+		if err := port.checkEnabled(); err != nil {
+			return err
+		}
+		d, err := port.readDirection()
+		if err != nil {
+			return err
+		}
+		if d != direction_out {
+			return fmt.Errorf("GPIO %v is not an output, and can not be part of a word", port.port)
+		}
+	}
+
+	debug("GPIO Writing word 0x%x to %v\n", value, pins)
+
+	for i := range ports {
+		bit := i
+		if cfg.reverse {
+			bit = len(ports) - 1 - i
+		}
+		val := low
+		if value&(1<<uint(bit)) != 0 {
+			val = high
+		}
+		if err := ports[bit].writeValue(val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
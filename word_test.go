@@ -0,0 +1,54 @@
+package gopisysfs
+
+import (
+	"testing"
+)
+
+func TestWriteWord(t *testing.T) {
+	SetLogFn(t.Logf)
+	fs := NewMemFS()
+	fs.AddGPIOChip(0, 54)
+	SetFileSystem(fs)
+	defer SetFileSystem(nil)
+
+	pi := GetDetailsFor(testrevision, testmodel)
+	pins := []int{5, 6, 13, 19}
+	for _, pin := range pins {
+		port, err := pi.OpenOutput(pin, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer port.Reset()
+	}
+
+	check := func(expect []bool) {
+		for i, pin := range pins {
+			port, _ := pi.GetPort(pin)
+			if val, err := port.Value(); err != nil || val != expect[i] {
+				t.Errorf("Expected GPIO %v to be %v but got %v (%v)", pin, expect[i], val, err)
+			}
+		}
+	}
+
+	if err := pi.WriteWord(pins, 0x9, 4); err != nil {
+		t.Fatal(err)
+	}
+	check([]bool{true, false, false, true})
+	if err := pi.WriteWord(pins, 0x2, 3, WordReverse()); err != nil {
+		t.Fatal(err)
+	}
+	check([]bool{false, true, false, true})
+
+	if err := pi.WriteWord(pins, 0x10, 4); err == nil {
+		t.Errorf("Expected an error writing a value that does not fit")
+	}
+	if err := pi.WriteWord([]int{5, 6, 5}, 0, 3); err == nil {
+		t.Errorf("Expected an error writing a pin twice")
+	}
+	if _, err := pi.OpenInput(testinport, GPIOEdgeNone); err != nil {
+		t.Fatal(err)
+	}
+	if err := pi.WriteWord([]int{5, testinport}, 0, 2); err == nil {
+		t.Errorf("Expected an error writing to an input")
+	}
+}